@@ -9,6 +9,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position right after the last character of the node
 }
 
 type Statement interface {
@@ -34,10 +36,39 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
 func (il *IntegerLiteral) String() string {
 	return il.TokenLiteral()
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+func (fl *FloatLiteral) String() string {
+	return fl.TokenLiteral()
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -48,6 +79,14 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	return endOf(pe.Right, pe.Token.End)
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -72,6 +111,14 @@ func (oe *InfixExpression) TokenLiteral() string {
 	return oe.Token.Literal
 }
 
+func (oe *InfixExpression) Pos() token.Position {
+	return posOf(oe.Left, oe.Token.Pos)
+}
+
+func (oe *InfixExpression) End() token.Position {
+	return endOf(oe.Right, oe.Token.End)
+}
+
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -101,6 +148,36 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
+// posOf return the start of n, or fallback when n is missing
+func posOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+	return n.Pos()
+}
+
+// endOf return the end of n, or fallback when n is missing
+func endOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+	return n.End()
+}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -127,6 +204,20 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -143,6 +234,14 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -166,6 +265,14 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+func (rs *ReturnStatement) End() token.Position {
+	return endOf(rs.ReturnValue, rs.Token.End)
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -184,6 +291,14 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	return endOf(es.Expression, es.Token.End)
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -197,6 +312,14 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -216,6 +339,20 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -231,8 +368,9 @@ func (ie *IfExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the '{'
 	Statements []Statement
+	EndToken   token.Token // the '}'
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -241,6 +379,14 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BlockStatement) End() token.Position {
+	return bs.EndToken.End
+}
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -250,10 +396,195 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+type WhileStatement struct {
+	Token     token.Token // the 'while'
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return endOf(ws.Condition, ws.Token.End)
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement is for (Variable in Iterable) Body
+type ForStatement struct {
+	Token    token.Token // the 'for'
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Iterable, fs.Token.End)
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for")
+	out.WriteString("(" + fs.Variable.String() + " in " + fs.Iterable.String() + ")")
+	out.WriteString(" ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BreakStatement) End() token.Position {
+	return bs.Token.End
+}
+
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+func (cs *ContinueStatement) End() token.Position {
+	return cs.Token.End
+}
+
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
+// ThrowStatement is throw Value
+type ThrowStatement struct {
+	Token token.Token // the 'throw'
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+
+func (ts *ThrowStatement) End() token.Position {
+	return endOf(ts.Value, ts.Token.End)
+}
+
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// TryStatement is try Block catch (Param) Catch finally Finally, one of
+// Catch and Finally may be nil
+type TryStatement struct {
+	Token   token.Token // the 'try'
+	Block   *BlockStatement
+	Param   *Identifier // nil without catch
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (ts *TryStatement) statementNode() {}
+
+func (ts *TryStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+
+func (ts *TryStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+
+func (ts *TryStatement) End() token.Position {
+	switch {
+	case ts.Finally != nil:
+		return ts.Finally.End()
+	case ts.Catch != nil:
+		return ts.Catch.End()
+	case ts.Block != nil:
+		return ts.Block.End()
+	}
+	return ts.Token.End
+}
+
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(ts.Block.String())
+	if ts.Catch != nil {
+		out.WriteString(" catch (" + ts.Param.String() + ") ")
+		out.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // name of the let binding the function, if any
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -262,6 +593,17 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
@@ -277,10 +619,51 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral is macro(params) { body }, it only live until the macro
+// expansion phase
+type MacroLiteral struct {
+	Token      token.Token // the 'macro'
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
+
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token // the '('
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	EndToken  token.Token // the ')'
 }
 
 func (ce *CallExpression) expressionNode() {
@@ -291,6 +674,14 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+func (ce *CallExpression) Pos() token.Position {
+	return posOf(ce.Function, ce.Token.Pos)
+}
+
+func (ce *CallExpression) End() token.Position {
+	return ce.EndToken.End
+}
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -316,13 +707,22 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
+
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
 
 type ArrayLiteral struct {
-	Token    token.Token
+	Token    token.Token // the '['
 	Elements []Expression
+	EndToken token.Token // the ']'
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -343,10 +743,19 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+func (al *ArrayLiteral) End() token.Position {
+	return al.EndToken.End
+}
+
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token // the '['
+	Left     Expression
+	Index    Expression
+	EndToken token.Token // the ']'
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -355,6 +764,14 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Pos() token.Position {
+	return posOf(ie.Left, ie.Token.Pos)
+}
+
+func (ie *IndexExpression) End() token.Position {
+	return ie.EndToken.End
+}
+
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -367,9 +784,43 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression store Value into Target, the result is the value
+type AssignExpression struct {
+	Token  token.Token // the '='
+	Target Expression  // an Identifier or an IndexExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) Pos() token.Position {
+	return posOf(ae.Target, ae.Token.Pos)
+}
+
+func (ae *AssignExpression) End() token.Position {
+	return endOf(ae.Value, ae.Token.End)
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token    token.Token // the '{'
+	Pairs    map[Expression]Expression
+	EndToken token.Token // the '}'
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -378,6 +829,14 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
 
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+func (hl *HashLiteral) End() token.Position {
+	return hl.EndToken.End
+}
+
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
@@ -390,3 +849,207 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// MatchExpression is match (Value) { pattern [if guard] => body, ... }
+type MatchExpression struct {
+	Token    token.Token // the 'match'
+	Value    Expression
+	Arms     []*MatchArm
+	EndToken token.Token // the '}'
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+
+func (me *MatchExpression) End() token.Position {
+	return me.EndToken.End
+}
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	out.WriteString("match")
+	out.WriteString("(" + me.Value.String() + ") ")
+	out.WriteString("{ ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+type MatchArm struct {
+	Token   token.Token // the '=>'
+	Pattern Pattern
+	Guard   Expression // may be nil
+	Body    Expression
+}
+
+func (ma *MatchArm) TokenLiteral() string {
+	return ma.Token.Literal
+}
+
+func (ma *MatchArm) Pos() token.Position {
+	return ma.Pattern.Pos()
+}
+
+func (ma *MatchArm) End() token.Position {
+	return endOf(ma.Body, ma.Token.End)
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// Pattern is the left side of a match arm
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, it match anything
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode() {}
+
+func (wp *WildcardPattern) TokenLiteral() string {
+	return wp.Token.Literal
+}
+
+func (wp *WildcardPattern) Pos() token.Position {
+	return wp.Token.Pos
+}
+
+func (wp *WildcardPattern) End() token.Position {
+	return wp.Token.End
+}
+
+func (wp *WildcardPattern) String() string {
+	return "_"
+}
+
+// BindingPattern match anything and bind the value to Name
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode() {}
+
+func (bp *BindingPattern) TokenLiteral() string {
+	return bp.Name.TokenLiteral()
+}
+
+func (bp *BindingPattern) Pos() token.Position {
+	return bp.Name.Pos()
+}
+
+func (bp *BindingPattern) End() token.Position {
+	return bp.Name.End()
+}
+
+func (bp *BindingPattern) String() string {
+	return bp.Name.String()
+}
+
+// LiteralPattern match a value equal to a number, string or boolean
+// literal, a negative number is a PrefixExpression
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode() {}
+
+func (lp *LiteralPattern) TokenLiteral() string {
+	return lp.Value.TokenLiteral()
+}
+
+func (lp *LiteralPattern) Pos() token.Position {
+	return lp.Value.Pos()
+}
+
+func (lp *LiteralPattern) End() token.Position {
+	return lp.Value.End()
+}
+
+func (lp *LiteralPattern) String() string {
+	return lp.Value.String()
+}
+
+// ArrayPattern match an array of the same length whose elements match
+type ArrayPattern struct {
+	Token    token.Token // the '['
+	Elements []Pattern
+	EndToken token.Token // the ']'
+}
+
+func (ap *ArrayPattern) patternNode() {}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+
+func (ap *ArrayPattern) End() token.Position {
+	return ap.EndToken.End
+}
+
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern match a hash having all the keys, with values matching.
+// Other keys are ignored.
+type HashPattern struct {
+	Token    token.Token // the '{'
+	Keys     []Expression
+	Values   []Pattern
+	EndToken token.Token // the '}'
+}
+
+func (hp *HashPattern) patternNode() {}
+
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+
+func (hp *HashPattern) End() token.Position {
+	return hp.EndToken.End
+}
+
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
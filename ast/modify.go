@@ -0,0 +1,229 @@
+package ast
+
+// ModifierFunc return the node replacing its argument
+type ModifierFunc func(Node) Node
+
+// Modify return a copy of the tree under node where every node has been
+// passed through modifier, children before their parent. The original
+// tree is not changed, so a macro body can be expanded many times.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		n := *node
+		n.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&n)
+	case *ExpressionStatement:
+		n := *node
+		n.Expression = modifyExpression(node.Expression, modifier)
+		return modifier(&n)
+	case *LetStatement:
+		n := *node
+		n.Name = modifyIdentifier(node.Name, modifier)
+		n.Value = modifyExpression(node.Value, modifier)
+		return modifier(&n)
+	case *ReturnStatement:
+		n := *node
+		n.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+		return modifier(&n)
+	case *BlockStatement:
+		n := *node
+		n.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&n)
+	case *WhileStatement:
+		n := *node
+		n.Condition = modifyExpression(node.Condition, modifier)
+		n.Body = modifyBlock(node.Body, modifier)
+		return modifier(&n)
+	case *ForStatement:
+		n := *node
+		n.Variable = modifyIdentifier(node.Variable, modifier)
+		n.Iterable = modifyExpression(node.Iterable, modifier)
+		n.Body = modifyBlock(node.Body, modifier)
+		return modifier(&n)
+	case *ThrowStatement:
+		n := *node
+		n.Value = modifyExpression(node.Value, modifier)
+		return modifier(&n)
+	case *TryStatement:
+		n := *node
+		n.Block = modifyBlock(node.Block, modifier)
+		n.Param = modifyIdentifier(node.Param, modifier)
+		n.Catch = modifyBlock(node.Catch, modifier)
+		n.Finally = modifyBlock(node.Finally, modifier)
+		return modifier(&n)
+	case *BreakStatement:
+		n := *node
+		return modifier(&n)
+	case *ContinueStatement:
+		n := *node
+		return modifier(&n)
+	case *Identifier:
+		n := *node
+		return modifier(&n)
+	case *IntegerLiteral:
+		n := *node
+		return modifier(&n)
+	case *FloatLiteral:
+		n := *node
+		return modifier(&n)
+	case *StringLiteral:
+		n := *node
+		return modifier(&n)
+	case *Boolean:
+		n := *node
+		return modifier(&n)
+	case *PrefixExpression:
+		n := *node
+		n.Right = modifyExpression(node.Right, modifier)
+		return modifier(&n)
+	case *InfixExpression:
+		n := *node
+		n.Left = modifyExpression(node.Left, modifier)
+		n.Right = modifyExpression(node.Right, modifier)
+		return modifier(&n)
+	case *IfExpression:
+		n := *node
+		n.Condition = modifyExpression(node.Condition, modifier)
+		n.Consequence = modifyBlock(node.Consequence, modifier)
+		n.Alternative = modifyBlock(node.Alternative, modifier)
+		return modifier(&n)
+	case *FunctionLiteral:
+		n := *node
+		n.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		n.Body = modifyBlock(node.Body, modifier)
+		return modifier(&n)
+	case *MacroLiteral:
+		n := *node
+		n.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		n.Body = modifyBlock(node.Body, modifier)
+		return modifier(&n)
+	case *CallExpression:
+		n := *node
+		n.Function = modifyExpression(node.Function, modifier)
+		n.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&n)
+	case *ArrayLiteral:
+		n := *node
+		n.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&n)
+	case *IndexExpression:
+		n := *node
+		n.Left = modifyExpression(node.Left, modifier)
+		n.Index = modifyExpression(node.Index, modifier)
+		return modifier(&n)
+	case *AssignExpression:
+		n := *node
+		n.Target = modifyExpression(node.Target, modifier)
+		n.Value = modifyExpression(node.Value, modifier)
+		return modifier(&n)
+	case *HashLiteral:
+		n := *node
+		n.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for key, val := range node.Pairs {
+			n.Pairs[modifyExpression(key, modifier)] = modifyExpression(val, modifier)
+		}
+		return modifier(&n)
+	case *MatchExpression:
+		n := *node
+		n.Value = modifyExpression(node.Value, modifier)
+		n.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			if arm != nil {
+				n.Arms[i], _ = Modify(arm, modifier).(*MatchArm)
+			}
+		}
+		return modifier(&n)
+	case *MatchArm:
+		n := *node
+		n.Pattern = modifyPattern(node.Pattern, modifier)
+		n.Guard = modifyExpression(node.Guard, modifier)
+		n.Body = modifyExpression(node.Body, modifier)
+		return modifier(&n)
+	case *WildcardPattern:
+		n := *node
+		return modifier(&n)
+	case *BindingPattern:
+		n := *node
+		n.Name = modifyIdentifier(node.Name, modifier)
+		return modifier(&n)
+	case *LiteralPattern:
+		n := *node
+		n.Value = modifyExpression(node.Value, modifier)
+		return modifier(&n)
+	case *ArrayPattern:
+		n := *node
+		n.Elements = make([]Pattern, len(node.Elements))
+		for i, el := range node.Elements {
+			n.Elements[i] = modifyPattern(el, modifier)
+		}
+		return modifier(&n)
+	case *HashPattern:
+		n := *node
+		n.Keys = modifyExpressions(node.Keys, modifier)
+		n.Values = make([]Pattern, len(node.Values))
+		for i, val := range node.Values {
+			n.Values[i] = modifyPattern(val, modifier)
+		}
+		return modifier(&n)
+	}
+
+	return modifier(node)
+}
+
+// the helpers skip the nil children, a missing else or guard stay missing
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	ret, _ := Modify(exp, modifier).(Expression)
+	return ret
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) []Expression {
+	ret := make([]Expression, len(exps))
+	for i, exp := range exps {
+		ret[i] = modifyExpression(exp, modifier)
+	}
+	return ret
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) []Statement {
+	ret := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		ret[i], _ = Modify(stmt, modifier).(Statement)
+	}
+	return ret
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	ret, _ := Modify(ident, modifier).(*Identifier)
+	return ret
+}
+
+func modifyIdentifiers(idents []*Identifier, modifier ModifierFunc) []*Identifier {
+	ret := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		ret[i] = modifyIdentifier(ident, modifier)
+	}
+	return ret
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	ret, _ := Modify(block, modifier).(*BlockStatement)
+	return ret
+}
+
+func modifyPattern(pattern Pattern, modifier ModifierFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	ret, _ := Modify(pattern, modifier).(Pattern)
+	return ret
+}
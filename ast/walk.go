@@ -0,0 +1,176 @@
+package ast
+
+import "sort"
+
+// A Visitor's Visit method is called for each node met by Walk. If the
+// result w is not nil, Walk visit each of the children of node with w,
+// then call w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverse the tree under node depth-first, children in source
+// order. The nil children (a missing else, guard...) are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *WhileStatement:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Body)
+	case *ForStatement:
+		walkIdentifier(v, n.Variable)
+		walkExpression(v, n.Iterable)
+		walkBlock(v, n.Body)
+	case *ThrowStatement:
+		walkExpression(v, n.Value)
+	case *TryStatement:
+		walkBlock(v, n.Block)
+		walkIdentifier(v, n.Param)
+		walkBlock(v, n.Catch)
+		walkBlock(v, n.Finally)
+	case *BreakStatement, *ContinueStatement, *Identifier, *IntegerLiteral,
+		*FloatLiteral, *StringLiteral, *Boolean, *WildcardPattern:
+		// leaves
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *FunctionLiteral:
+		walkIdentifiers(v, n.Parameters)
+		walkBlock(v, n.Body)
+	case *MacroLiteral:
+		walkIdentifiers(v, n.Parameters)
+		walkBlock(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *AssignExpression:
+		walkExpression(v, n.Target)
+		walkExpression(v, n.Value)
+	case *HashLiteral:
+		// map的顺序不固定，按key在源码里的位置走
+		keys := make([]Expression, 0, len(n.Pairs))
+		for key := range n.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Pos().Offset < keys[j].Pos().Offset
+		})
+		for _, key := range keys {
+			walkExpression(v, key)
+			walkExpression(v, n.Pairs[key])
+		}
+	case *MatchExpression:
+		walkExpression(v, n.Value)
+		for _, arm := range n.Arms {
+			if arm != nil {
+				Walk(v, arm)
+			}
+		}
+	case *MatchArm:
+		walkPattern(v, n.Pattern)
+		walkExpression(v, n.Guard)
+		walkExpression(v, n.Body)
+	case *BindingPattern:
+		walkIdentifier(v, n.Name)
+	case *LiteralPattern:
+		walkExpression(v, n.Value)
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			walkPattern(v, el)
+		}
+	case *HashPattern:
+		for i, key := range n.Keys {
+			walkExpression(v, key)
+			if i < len(n.Values) {
+				walkPattern(v, n.Values[i])
+			}
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverse the tree like Walk, calling f(node) for each node. If
+// f return false the children of node are skipped. After the children f
+// is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		walkExpression(v, exp)
+	}
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkIdentifier(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+func walkIdentifiers(v Visitor, idents []*Identifier) {
+	for _, ident := range idents {
+		walkIdentifier(v, ident)
+	}
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+	if block != nil {
+		Walk(v, block)
+	}
+}
+
+func walkPattern(v Visitor, pattern Pattern) {
+	if pattern != nil {
+		Walk(v, pattern)
+	}
+}
@@ -0,0 +1,226 @@
+package ast_test
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// everyNode use every kind of node declared in ast.go
+const everyNode = `
+let x = 1;
+let f = fn(a) { return a; };
+let m = macro(q) { q };
+while (true) { break; continue; }
+for (i in [1.5, "s"]) { x = -i; }
+if (x < 2) { f(x)[0] } else { {1: 2} }
+match (x) { _ => 1, y => y, 1 => 2, [z] => z, {"k": w} if w => w }
+try { throw x; } catch (e) { e } finally { x }
+`
+
+// nodeTypes return the names of the node types declared in ast.go, the
+// types having a Pos method
+func nodeTypes(t *testing.T) []string {
+	t.Helper()
+
+	file, err := goparser.ParseFile(gotoken.NewFileSet(), "ast.go", nil, 0)
+	if err != nil {
+		t.Fatalf("cannot parse ast.go: %s", err)
+	}
+	names := []string{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "Pos" {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*goast.StarExpr)
+		if !ok {
+			continue
+		}
+		names = append(names, star.X.(*goast.Ident).Name)
+	}
+	if len(names) == 0 {
+		t.Fatalf("no node type found in ast.go")
+	}
+	return names
+}
+
+func parseEveryNode(t *testing.T) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(everyNode))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func typeName(node ast.Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+// children find the child nodes of node by reflection, independently of
+// the walker under test
+func children(node ast.Node) []ast.Node {
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	ret := []ast.Node{}
+
+	var collect func(f reflect.Value)
+	collect = func(f reflect.Value) {
+		switch f.Kind() {
+		case reflect.Slice:
+			for i := 0; i < f.Len(); i++ {
+				collect(f.Index(i))
+			}
+			return
+		case reflect.Map:
+			iter := f.MapRange()
+			for iter.Next() {
+				collect(iter.Key())
+				collect(iter.Value())
+			}
+			return
+		case reflect.Interface, reflect.Ptr:
+			if f.IsNil() {
+				return
+			}
+		default:
+			return
+		}
+		if f.Type().Implements(nodeType) {
+			ret = append(ret, f.Interface().(ast.Node))
+		} else if f.Kind() == reflect.Interface && f.Elem().Type().Implements(nodeType) {
+			ret = append(ret, f.Elem().Interface().(ast.Node))
+		}
+	}
+
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		collect(v.Field(i))
+	}
+	return ret
+}
+
+func TestWalkCoverEveryNode(t *testing.T) {
+	program := parseEveryNode(t)
+
+	visited := map[ast.Node]bool{}
+	kinds := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited[node] = true
+			kinds[typeName(node)] = true
+		}
+		return true
+	})
+
+	for _, name := range nodeTypes(t) {
+		if !kinds[name] {
+			t.Errorf("%s never visited, add it to the test program or to Walk", name)
+		}
+	}
+	// every child of a visited node is visited too
+	for node := range visited {
+		for _, child := range children(node) {
+			if !visited[child] {
+				t.Errorf("child %s (%s) of %s not visited", typeName(child), child, typeName(node))
+			}
+		}
+	}
+}
+
+func TestModifyCoverEveryNode(t *testing.T) {
+	program := parseEveryNode(t)
+
+	original := map[ast.Node]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			original[node] = true
+		}
+		return true
+	})
+
+	kinds := map[string]bool{}
+	modified := ast.Modify(program, func(node ast.Node) ast.Node {
+		kinds[typeName(node)] = true
+		return node
+	})
+
+	for _, name := range nodeTypes(t) {
+		if !kinds[name] {
+			t.Errorf("%s never modified, add it to the test program or to Modify", name)
+		}
+	}
+	// the result is a copy, no node is shared with the original
+	ast.Inspect(modified, func(node ast.Node) bool {
+		if node != nil && original[node] {
+			t.Errorf("%s (%s) shared with the original tree", typeName(node), node)
+		}
+		return true
+	})
+	if modified.String() != program.String() {
+		t.Errorf("identity modify changed the program. got=%q, want=%q", modified.String(), program.String())
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	p := parser.New(lexer.New(`let a = b + c; {d: e, f: g}; h(i, j)[k]`))
+	program := p.ParseProgram()
+
+	names := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+
+	if strings.Join(names, " ") != "a b c d e f g h i j k" {
+		t.Errorf("wrong walk order. got=%v", names)
+	}
+}
+
+func TestInspectSkipChildren(t *testing.T) {
+	p := parser.New(lexer.New(`f(fn(x) { x + 1 }, y)`))
+	program := p.ParseProgram()
+
+	visited := []string{}
+	depth, maxDepth := 0, 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			visited = append(visited, ident.Value)
+		}
+		_, isFunction := node.(*ast.FunctionLiteral)
+		if isFunction {
+			// 跳过的节点不会有结尾的nil
+			depth--
+		}
+		return !isFunction
+	})
+
+	if strings.Join(visited, " ") != "f y" {
+		t.Errorf("function body not skipped. got=%v", visited)
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) calls not balanced. depth=%d", depth)
+	}
+	// Program > ExpressionStatement > CallExpression > Identifier
+	if maxDepth != 4 {
+		t.Errorf("wrong depth. want=4, got=%d", maxDepth)
+	}
+}
@@ -21,6 +21,13 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
 
 	OpPop
 
@@ -29,12 +36,20 @@ const (
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
 
 	OpPrefixMinus
 	OpBang
+	OpBitNot
 
 	OpJumpNotTruthy
 	OpJump
+	// OpJumpNotTruthyOrPop and OpJumpTruthyOrPop keep the tested value on
+	// the stack when they jump, and pop it otherwise, they make && and ||
+	OpJumpNotTruthyOrPop
+	OpJumpTruthyOrPop
 
 	OpNull
 
@@ -48,6 +63,19 @@ const (
 
 	// OpIndex is index operation for array or hash
 	OpIndex
+	// OpSetIndex store the top of stack into left[index], the value is
+	// pushed back as the result of the assignment
+	OpSetIndex
+
+	// OpMatch pop a value and test it against the pattern constant, on
+	// success the bound values then true are pushed, otherwise only false
+	OpMatch
+
+	// OpIter replace the iterable on the top of stack by an iterator
+	OpIter
+	// OpIterNext pop the iterator and push its next element, or jump when
+	// it is exhausted
+	OpIterNext
 
 	OpCall
 	OpReturnValue
@@ -57,6 +85,17 @@ const (
 
 	OpClosure
 	OpGetFree
+	OpSetFree
+	// OpCaptureLocal and OpCaptureFree push the upvalue of a local or of a
+	// free variable of the current closure, OpClosure collect them
+	OpCaptureLocal
+	OpCaptureFree
+	// OpCurrentClosure push the closure being executed, for self reference
+	OpCurrentClosure
+
+	// OpThrow pop a value and raise it, the VM jump to the handler of the
+	// instruction in the handler table
+	OpThrow
 )
 
 // Definition 其实主要用于取操作数
@@ -89,6 +128,34 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpDiv",
 		OperandWidth: []int{},
 	},
+	OpMod: &Definition{
+		Name:         "OpMod",
+		OperandWidth: []int{},
+	},
+	OpPow: &Definition{
+		Name:         "OpPow",
+		OperandWidth: []int{},
+	},
+	OpBitAnd: &Definition{
+		Name:         "OpBitAnd",
+		OperandWidth: []int{},
+	},
+	OpBitOr: &Definition{
+		Name:         "OpBitOr",
+		OperandWidth: []int{},
+	},
+	OpBitXor: &Definition{
+		Name:         "OpBitXor",
+		OperandWidth: []int{},
+	},
+	OpShiftLeft: &Definition{
+		Name:         "OpShiftLeft",
+		OperandWidth: []int{},
+	},
+	OpShiftRight: &Definition{
+		Name:         "OpShiftRight",
+		OperandWidth: []int{},
+	},
 	OpPop: &Definition{
 		Name:         "OpPop",
 		OperandWidth: []int{},
@@ -114,6 +181,18 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpGreaterThan",
 		OperandWidth: []int{},
 	},
+	OpGreaterEqual: &Definition{
+		Name:         "OpGreaterEqual",
+		OperandWidth: []int{},
+	},
+	OpLessThan: &Definition{
+		Name:         "OpLessThan",
+		OperandWidth: []int{},
+	},
+	OpLessEqual: &Definition{
+		Name:         "OpLessEqual",
+		OperandWidth: []int{},
+	},
 
 	OpPrefixMinus: &Definition{
 		Name:         "OpPrefixMinus",
@@ -123,6 +202,10 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpBang",
 		OperandWidth: []int{},
 	},
+	OpBitNot: &Definition{
+		Name:         "OpBitNot",
+		OperandWidth: []int{},
+	},
 	OpJumpNotTruthy: &Definition{
 		Name:         "OpJumpNotTruthy",
 		OperandWidth: []int{2},
@@ -131,6 +214,14 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpJump",
 		OperandWidth: []int{2},
 	},
+	OpJumpNotTruthyOrPop: &Definition{
+		Name:         "OpJumpNotTruthyOrPop",
+		OperandWidth: []int{2},
+	},
+	OpJumpTruthyOrPop: &Definition{
+		Name:         "OpJumpTruthyOrPop",
+		OperandWidth: []int{2},
+	},
 	OpNull: &Definition{
 		Name:         "OpNull",
 		OperandWidth: []int{},
@@ -155,6 +246,22 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpIndex",
 		OperandWidth: []int{},
 	},
+	OpSetIndex: &Definition{
+		Name:         "OpSetIndex",
+		OperandWidth: []int{},
+	},
+	OpMatch: &Definition{
+		Name:         "OpMatch",
+		OperandWidth: []int{2},
+	},
+	OpIter: &Definition{
+		Name:         "OpIter",
+		OperandWidth: []int{},
+	},
+	OpIterNext: &Definition{
+		Name:         "OpIterNext",
+		OperandWidth: []int{2},
+	},
 	OpCall: &Definition{
 		Name:         "OpCall",
 		OperandWidth: []int{1},
@@ -191,6 +298,26 @@ var definitions = map[OpCode]*Definition{
 		Name:         "OpGetFree",
 		OperandWidth: []int{1},
 	},
+	OpSetFree: &Definition{
+		Name:         "OpSetFree",
+		OperandWidth: []int{1},
+	},
+	OpCaptureLocal: &Definition{
+		Name:         "OpCaptureLocal",
+		OperandWidth: []int{1},
+	},
+	OpCaptureFree: &Definition{
+		Name:         "OpCaptureFree",
+		OperandWidth: []int{1},
+	},
+	OpCurrentClosure: &Definition{
+		Name:         "OpCurrentClosure",
+		OperandWidth: []int{},
+	},
+	OpThrow: &Definition{
+		Name:         "OpThrow",
+		OperandWidth: []int{},
+	},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -7,6 +7,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
 	"sort"
 )
 
@@ -19,6 +20,32 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// enclosing loops of the current position, innermost last
+	loops []*loopContext
+
+	// line table of the instructions
+	lines []object.SourcePos
+
+	// values pushed by the enclosing expressions and still on the stack,
+	// above the locals
+	depth int
+	// enclosing try statements of the current position, innermost last
+	tries []*tryContext
+	// handler table of the instructions
+	handlers []object.Handler
+}
+
+type loopContext struct {
+	// where continue jump to, known before compiling the body
+	continuePos int
+	// break jumps, patched once the end of the loop is known
+	breakPos []int
+	// number of enclosing tries outside the loop
+	tries int
+	// operands on the stack outside the loop, a break or continue inside
+	// an expression pop back to it
+	depth int
 }
 
 type Compiler struct {
@@ -31,6 +58,12 @@ type Compiler struct {
 	// scope
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// errors found so far, the compilation goes on after most of them
+	errors ErrorList
+
+	// source position of the node being compiled, for the line table
+	pos token.Position
 }
 
 type EmittedInstruction struct {
@@ -66,40 +99,58 @@ func New() *Compiler {
 	}
 }
 
+// Compile compile node, the errors are returned as an ErrorList. An
+// undefined name does not stop the compilation, so all of them are found.
 func (c *Compiler) Compile(node ast.Node) error {
+	c.errors = nil
+	if err := c.compile(node); err != nil {
+		if e, ok := err.(*Error); ok {
+			c.errors = append(c.errors, e)
+		} else {
+			c.errors = append(c.errors, &Error{Pos: node.Pos(), Msg: err.Error()})
+		}
+	}
+	return c.errors.Err()
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	// the instructions emitted for node and not for a child are at its position
+	if node != nil && node.Pos().IsValid() {
+		defer func(outer token.Position) { c.pos = outer }(c.pos)
+		c.pos = node.Pos()
+	}
+	// the operands kept by node are popped once it is compiled
+	defer func(depth int) { c.scopes[c.scopeIndex].depth = depth }(c.scopes[c.scopeIndex].depth)
+
 	switch node := node.(type) {
 	case *ast.Program:
+		// 先声明所有顶层的let，全局函数之间可以前向引用
 		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
+			if let, ok := s.(*ast.LetStatement); ok && let != nil {
+				c.defineLet(let.Name.Value)
 			}
 		}
+		err := c.compileStatements(node.Statements)
+		if err != nil {
+			return err
+		}
 	case *ast.ExpressionStatement:
-		err := c.Compile(node.Expression)
+		err := c.compile(node.Expression)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 
-		err := c.Compile(node.Left)
+		err := c.compile(node.Left)
 		if err != nil {
 			return err
 		}
-		err = c.Compile(node.Right)
+		c.keep()
+		err = c.compile(node.Right)
 		if err != nil {
 			return err
 		}
@@ -112,17 +163,37 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unkown operator %s", node.Operator)
+			return &Error{Pos: node.Pos(), Msg: fmt.Sprintf("unknown operator %s", node.Operator)}
 		}
 	case *ast.PrefixExpression:
-		err := c.Compile(node.Right)
+		err := c.compile(node.Right)
 		if err != nil {
 			return err
 		}
@@ -131,12 +202,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpPrefixMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return &Error{Pos: node.Pos(), Msg: fmt.Sprintf("unknown operator %s", node.Operator)}
 		}
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -147,7 +223,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.IfExpression:
 		// overview:
 		// 1.jumpWhenNotTrue / 2.consequence / 3.jump /  4.alternate || null /
-		err := c.Compile(node.Condition)
+		err := c.compile(node.Condition)
 		if err != nil {
 			return err
 		}
@@ -155,13 +231,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, Magic)
 
 		// section 2: consequence
-		err = c.Compile(node.Consequence)
+		err = c.compile(node.Consequence)
 		if err != nil {
 			return err
 		}
-		// dedup pop
+		// dedup pop, a block without value (let, loop...) give null
 		if c.lastInstructionIs(code.OpPop) {
 			c.removeLastPop()
+		} else {
+			c.emit(code.OpNull)
 		}
 		// consequence end
 		// section 3: jump
@@ -174,41 +252,119 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else { // else part
-			err := c.Compile(node.Alternative)
+			err := c.compile(node.Alternative)
 			if err != nil {
 				return err
 			}
 			if c.lastInstructionIs(code.OpPop) {
 				c.removeLastPop()
+			} else {
+				c.emit(code.OpNull)
 			}
 		}
 
 		afterAlternativePos := len(c.currentInstruction())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
 	case *ast.BlockStatement:
-		for _, s := range node.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
-			}
+		err := c.compileStatements(node.Statements)
+		if err != nil {
+			return err
 		}
-	case *ast.LetStatement:
-		// 这里只标注序列，值会在执行时放在stack上
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+	case *ast.WhileStatement:
+		// overview:
+		// 1.condition / 2.jumpWhenNotTrue to 5 / 3.body / 4.jump to 1 /
+		// 5.null as the value of the loop
+		loopStartPos := len(c.currentInstruction())
+		err := c.compile(node.Condition)
 		if err != nil {
 			return err
 		}
+		exitPos := c.emit(code.OpJumpNotTruthy, Magic)
 
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		c.enterLoop(loopStartPos)
+		err = c.compile(node.Body)
+		if err != nil {
+			return err
 		}
+		c.emit(code.OpJump, loopStartPos)
+
+		afterLoopPos := len(c.currentInstruction())
+		c.changeOperand(exitPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+		c.popNull()
+	case *ast.ForStatement:
+		// the iterator live in a hidden variable, so the stack is clean
+		// between statements and break/continue are plain jumps
+		// overview:
+		// 1.iterator / 2.next or jump to 5 / 3.body / 4.jump to 2 /
+		// 5.null as the value of the loop
+		err := c.compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIter)
+		iterator := c.symbolTable.Define(fmt.Sprintf("@iter%d", len(c.scopes[c.scopeIndex].loops)))
+		c.storeSymbol(&iterator)
+
+		loopStartPos := len(c.currentInstruction())
+		c.loadSymbol(&iterator)
+		exitPos := c.emit(code.OpIterNext, Magic)
+		// as in the evaluator, a variable of the same scope is reused
+		variable := c.symbolTable.DeclareVariable(node.Variable.Value)
+		c.storeSymbol(&variable)
+
+		c.enterLoop(loopStartPos)
+		err = c.compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopStartPos)
+
+		afterLoopPos := len(c.currentInstruction())
+		c.changeOperand(exitPos, afterLoopPos)
+		c.leaveLoop(afterLoopPos)
+		c.popNull()
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			c.errorf(node, "break outside loop")
+			return nil
+		}
+		c.leaveExpressions(loop)
+		loop.breakPos = append(loop.breakPos, c.emit(code.OpJump, Magic))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			c.errorf(node, "continue outside loop")
+			return nil
+		}
+		c.leaveExpressions(loop)
+		c.emit(code.OpJump, loop.continuePos)
+	case *ast.ThrowStatement:
+		err := c.compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.LetStatement:
+		// 这里只标注序列，值会在执行时放在stack上
+		symbol := c.defineLet(node.Name.Value)
+		err := c.compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(&symbol)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			// 继续编译，找出所有未定义的名字
+			c.undefinedError(node)
+			c.emit(code.OpNull)
+			return nil
 		}
 		c.loadSymbol(&symbol)
 
@@ -217,10 +373,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpConstant, c.addConstant(str))
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
-			err := c.Compile(el)
+			err := c.compile(el)
 			if err != nil {
 				return err
 			}
+			c.keep()
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
@@ -232,34 +389,66 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return keys[i].String() < keys[j].String()
 		})
 		for _, k := range keys {
-			err := c.Compile(k)
+			err := c.compile(k)
 			if err != nil {
 				return err
 			}
-			err = c.Compile(node.Pairs[k])
+			c.keep()
+			err = c.compile(node.Pairs[k])
 			if err != nil {
 				return err
 			}
+			c.keep()
 		}
 		c.emit(code.OpHash, len(keys)*2)
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
+		err := c.compile(node.Left)
 		if err != nil {
 			return err
 		}
-		err = c.Compile(node.Index)
+		c.keep()
+		err = c.compile(node.Index)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.AssignExpression:
+		if ident, ok := node.Target.(*ast.Identifier); ok {
+			return c.compileAssignIdentifier(ident, node.Value)
+		}
+		target, ok := node.Target.(*ast.IndexExpression)
+		if !ok {
+			c.errorf(node, "invalid assignment target %s", node.Target.String())
+			return c.compile(node.Value)
+		}
+		err := c.compile(target.Left)
+		if err != nil {
+			return err
+		}
+		c.keep()
+		err = c.compile(target.Index)
+		if err != nil {
+			return err
+		}
+		c.keep()
+		err = c.compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
 	case *ast.FunctionLiteral:
 		c.enterScope()
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
 		// before body, define arguments as localbinding
-		for _, p := range node.Parameters {
+		params := make([]string, len(node.Parameters))
+		for i, p := range node.Parameters {
 			c.symbolTable.Define(p.Value)
+			params[i] = p.Value
 		}
 
-		err := c.Compile(node.Body)
+		err := c.compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -275,6 +464,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// just leaving
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		lines := c.scopes[c.scopeIndex].lines
+		handlers := c.scopes[c.scopeIndex].handlers
 		instructions := c.leaveScope()
 
 		// 将这些free变量拉到栈上是在离开内层的函数之后
@@ -285,14 +476,29 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// 按照free的定义a不在local变量，不是builtin，不是global，所以肯定是在某层嵌套的
 		// 函数里定义了此变量(这里也包括外层函数的参数，因为我们把参数按照local处理了)
 		// 那么我们在内层函数里取这个变量用的是OpGetFree
+		// 现在推到栈上的是变量的upvalue而不是值，这样闭包和外层共享同一个变量
 		for _, s := range freeSymbols {
-			c.loadSymbol(&s)
+			switch s.Scope {
+			case LocalScope:
+				c.emit(code.OpCaptureLocal, s.Index)
+			case FunctionScope:
+				// 外层函数自己，值不会变，OpClosure直接收下
+				c.emit(code.OpCurrentClosure)
+			default:
+				c.emit(code.OpCaptureFree, s.Index)
+			}
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Parameters:    params,
+			Pos:           node.Pos(),
+			End:           node.End(),
+			Lines:         lines,
+			Handlers:      handlers,
 		}
 		// legacy function without closure
 		// c.emit(code.OpConstant, c.addConstant(compiledFn))
@@ -300,23 +506,31 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// yes, closure data prepared
 		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
 
+	case *ast.MacroLiteral:
+		// 宏在编译前的展开阶段就去掉了
+		c.errorf(node, "macro must be bound by a top-level let")
+		c.emit(code.OpNull)
 	case *ast.ReturnStatement:
-		err := c.Compile(node.ReturnValue)
+		err := c.compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		c.keep()
+		c.exitTries(0)
 		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		err := c.compile(node.Function)
 
 		if err != nil {
 			return err
 		}
+		c.keep()
 		for _, a := range node.Arguments {
-			err := c.Compile(a)
+			err := c.compile(a)
 			if err != nil {
 				return err
 			}
+			c.keep()
 		}
 		c.emit(code.OpCall, len(node.Arguments))
 	}
@@ -324,6 +538,99 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// compileLogicalExpression compile && and || with a jump, so the right
+// side is only evaluated when needed. The result is the last evaluated
+// operand:
+// 1. left / 2. jump to 4 keeping left, or pop it / 3. right / 4.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	op := code.OpJumpNotTruthyOrPop
+	if node.Operator == "||" {
+		op = code.OpJumpTruthyOrPop
+	}
+	jumpPos := c.emit(op, Magic)
+
+	err = c.compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	afterRightPos := len(c.currentInstruction())
+	c.changeOperand(jumpPos, afterRightPos)
+
+	return nil
+}
+
+// compileMatchExpression compile the arms as a chain, the first matching
+// arm give the result, null when none match.
+// overview, for each arm:
+// 1.value / 2.match / 3.jumpWhenNotTrue to next arm / 4.bindings /
+// 5.guard, jumpWhenNotTrue to next arm / 6.body / 7.jump to end
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.compile(node.Value)
+	if err != nil {
+		return err
+	}
+	// keep the value in a hidden variable, each arm load it again
+	subject := c.symbolTable.Define("@match")
+	c.storeSymbol(&subject)
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		pattern, err := object.NewMatchPattern(arm.Pattern)
+		if err != nil {
+			c.errorf(arm.Pattern, "%s", err)
+			continue
+		}
+		c.loadSymbol(&subject)
+		c.emit(code.OpMatch, c.addConstant(pattern))
+		nextArmJumps := []int{c.emit(code.OpJumpNotTruthy, Magic)}
+
+		// the bound values are pushed in order, pop them backward. The
+		// bindings have their own slots, seen only by the guard and body.
+		restores := make([]func(), len(pattern.Bindings))
+		for i := len(pattern.Bindings) - 1; i >= 0; i-- {
+			symbol, restore := c.symbolTable.DefineScoped(pattern.Bindings[i])
+			restores[i] = restore
+			c.storeSymbol(&symbol)
+		}
+
+		if arm.Guard != nil {
+			err := c.compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			nextArmJumps = append(nextArmJumps, c.emit(code.OpJumpNotTruthy, Magic))
+		}
+
+		err = c.compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		for _, restore := range restores {
+			restore()
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, Magic))
+
+		nextArmPos := len(c.currentInstruction())
+		for _, pos := range nextArmJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+	c.emit(code.OpNull)
+
+	afterMatchPos := len(c.currentInstruction())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+
+	return nil
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 
@@ -338,9 +645,22 @@ func (c *Compiler) emit(op code.OpCode, operands ...int) int {
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
+	c.addLine(pos)
 	return pos
 }
 
+// addLine record that the instruction at pc come from the current node
+func (c *Compiler) addLine(pc int) {
+	if !c.pos.IsValid() {
+		return
+	}
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.lines); n > 0 && scope.lines[n-1].Pos == c.pos {
+		return
+	}
+	scope.lines = append(scope.lines, object.SourcePos{PC: pc, Pos: c.pos})
+}
+
 func (c *Compiler) replaceInstructions(pos int, newInstruction []byte) {
 	ins := c.currentInstruction()
 
@@ -380,6 +700,12 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].PC >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -393,15 +719,32 @@ type Bytecode struct {
 	Instructions code.Instructions
 	// pool里什么都放，int， string等
 	Constants []object.Object
+	// GlobalNames name the global slots, for runtime errors
+	GlobalNames []string
+	// Lines is the line table of Instructions
+	Lines []object.SourcePos
+	// Handlers is the handler table of Instructions
+	Handlers []object.Handler
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstruction(),
 		Constants:    c.constants,
+		GlobalNames:  c.globalSymbolTable().GlobalNames(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Handlers:     c.scopes[c.scopeIndex].handlers,
 	}
 }
 
+func (c *Compiler) globalSymbolTable() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -443,6 +786,89 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// storeSymbol pop the top of stack into a variable
+func (c *Compiler) storeSymbol(s *Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// compileAssignIdentifier change an existing variable, the assigned value
+// is left on the stack as the result
+func (c *Compiler) compileAssignIdentifier(ident *ast.Identifier, value ast.Expression) error {
+	// 给函数名赋值改的是持有函数的变量
+	symbol, ok := c.symbolTable.ResolveVariable(ident.Value)
+	if !ok || symbol.Scope == BuiltinScope {
+		if !ok {
+			c.undefinedError(ident)
+		} else {
+			c.errorf(ident, "cannot assign to builtin %s", ident.Value)
+		}
+		// the value may hold more errors
+		return c.compile(value)
+	}
+
+	err := c.compile(value)
+	if err != nil {
+		return err
+	}
+	c.storeSymbol(&symbol)
+	c.loadSymbol(&symbol)
+
+	return nil
+}
+
+// popNull leave null as the last popped value, the value of the
+// statements that have none, as in the evaluator
+func (c *Compiler) popNull() {
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+}
+
+func (c *Compiler) enterLoop(continuePos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loopContext{
+		continuePos: continuePos,
+		tries:       len(scope.tries),
+		depth:       scope.depth,
+	})
+}
+
+// leaveExpressions pop the operands kept since loop started and compile
+// the finallys on the way, before a break or continue jump out
+func (c *Compiler) leaveExpressions(loop *loopContext) {
+	scope := &c.scopes[c.scopeIndex]
+	for ; scope.depth > loop.depth; scope.depth-- {
+		c.emit(code.OpPop)
+	}
+	c.exitTries(loop.tries)
+}
+
+// leaveLoop patch the break jumps of the innermost loop to afterLoopPos
+func (c *Compiler) leaveLoop(afterLoopPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.breakPos {
+		c.changeOperand(pos, afterLoopPos)
+	}
+}
+
+// currentLoop return the innermost loop, nil outside any loop
+func (c *Compiler) currentLoop() *loopContext {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
 func (c *Compiler) loadSymbol(s *Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -453,5 +879,67 @@ func (c *Compiler) loadSymbol(s *Symbol) {
 		c.emit(code.OpGetBuiltin, s.Index)
 	case FreeScope:
 		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// compileStatements compile a statement list. The lets binding functions
+// are a letrec group: all their names are defined before any statement
+// is compiled, so the functions can call each other wherever they are in
+// the list. All the lets of a name of the group share its slot, a let
+// again change what the functions see, as in the evaluator.
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	group := map[string]Symbol{}
+	for _, let := range functionLets(stmts) {
+		if _, ok := group[let.Name.Value]; !ok {
+			group[let.Name.Value] = c.defineLet(let.Name.Value)
+		}
+	}
+	for _, stmt := range stmts {
+		let, _ := stmt.(*ast.LetStatement)
+		var symbol Symbol
+		inGroup := false
+		if let != nil {
+			symbol, inGroup = group[let.Name.Value]
+		}
+		if !inGroup {
+			err := c.compile(stmt)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := c.compile(let.Value)
+		if err != nil {
+			return err
+		}
+		// a let in a nested block may have moved the name, take it back
+		c.symbolTable.Rebind(symbol)
+		c.storeSymbol(&symbol)
+	}
+	return nil
+}
+
+// defineLet define the name bound by a let, a global keep its slot
+func (c *Compiler) defineLet(name string) Symbol {
+	if c.symbolTable.Outer == nil {
+		return c.symbolTable.Declare(name)
+	}
+	return c.symbolTable.Define(name)
+}
+
+// functionLets return the lets of stmts whose value is a function
+func functionLets(stmts []ast.Statement) []*ast.LetStatement {
+	group := []*ast.LetStatement{}
+	for _, s := range stmts {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let == nil {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			group = append(group, let)
+		}
 	}
+	return group
 }
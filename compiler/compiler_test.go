@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/code"
 	"monkey/object"
+	"strings"
 	"testing"
 )
 
@@ -75,6 +76,16 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "-3",
 			expectedConstants: []interface{}{3},
@@ -149,11 +160,21 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case float64:
+			float, ok := actual[i].(*object.Float)
+			if !ok || float.Value != constant {
+				return fmt.Errorf("constant %d - not float %g: %T (%+v)", i, constant, actual[i], actual[i])
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case matchPattern:
+			pattern, ok := actual[i].(*object.MatchPattern)
+			if !ok || pattern.Inspect() != string(constant) {
+				return fmt.Errorf("constant %d - not pattern %s: %T (%+v)", i, constant, actual[i], actual[i])
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -168,6 +189,9 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 	return nil
 }
 
+// matchPattern is an expected pattern constant, as given by Inspect
+type matchPattern string
+
 func testStringObject(expected string, actual object.Object) error {
 	ret, ok := actual.(*object.String)
 	if !ok {
@@ -221,11 +245,82 @@ func TestBooleanExpression(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 % 2 ** 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPow),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1 << 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthyOrPop, 5),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpTruthyOrPop, 5),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
 				code.Make(code.OpPop),
 			},
 		},
@@ -328,11 +423,270 @@ func TestConditionals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// a block without value give null
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 0),
+				// 0011, the value of the loop
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "while (true) { break; continue; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 13),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+				// 0013, the value of the loop
+				code.Make(code.OpNull),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpIterNext, 26),
+				// 0016
+				code.Make(code.OpSetGlobal, 1),
+				// 0019
+				code.Make(code.OpGetGlobal, 1),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpJump, 10),
+				// 0026, the value of the loop
+				code.Make(code.OpNull),
+				// 0027
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { while (true) { break; } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 10),
+					// 0004
+					code.Make(code.OpJump, 10),
+					// 0007
+					code.Make(code.OpJump, 0),
+					// 0010
+					code.Make(code.OpNull),
+					// 0011
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
 }
 
+func TestMatchExpression(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "match (1) { [x] if x => x, _ => 2 }",
+			expectedConstants: []interface{}{1, matchPattern("[x]"), matchPattern("_"), 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpMatch, 1),
+				// 0012
+				code.Make(code.OpJumpNotTruthy, 30),
+				// 0015
+				code.Make(code.OpSetGlobal, 1),
+				// 0018
+				code.Make(code.OpGetGlobal, 1),
+				// 0021
+				code.Make(code.OpJumpNotTruthy, 30),
+				// 0024
+				code.Make(code.OpGetGlobal, 1),
+				// 0027
+				code.Make(code.OpJump, 46),
+				// 0030
+				code.Make(code.OpGetGlobal, 0),
+				// 0033
+				code.Make(code.OpMatch, 2),
+				// 0036
+				code.Make(code.OpJumpNotTruthy, 45),
+				// 0039
+				code.Make(code.OpConstant, 3),
+				// 0042
+				code.Make(code.OpJump, 46),
+				// 0045
+				code.Make(code.OpNull),
+				// 0046
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = 1; a = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let a = 1; fn() { a = 2 } }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = 1;", "1:1: undefined variable a"},
+		{"len = 1;", "1:1: cannot assign to builtin len"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("%s: expected compiler error but resulted in none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong compiler error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"continue;", "1:1: continue outside loop"},
+		// a function body start a new scope, the loop is not visible
+		{"while (true) { fn() { break; } }", "1:23: break outside loop"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("%s: expected compiler error but resulted in none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong compiler error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -382,6 +736,50 @@ two;
 	runCompilerTests(t, tests)
 }
 
+func TestGlobalForwardReferences(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+let a = fn() { b() };
+let b = fn() { 1 };
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 1),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			// let again keep the slot
+			input:             "let x = 1; let x = 2; x",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -528,6 +926,25 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestIndexAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2][0] = 3",
+			expectedConstants: []interface{}{1, 2, 0, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -598,6 +1015,151 @@ func TestFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestFunctionMetadata(t *testing.T) {
+	input := "let add = fn(a, b) { a + b };\nlet f = fn() { fn(x) { x } };"
+	program := parse(input)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := []struct {
+		name   string
+		params []string
+		pos    string
+		end    string
+	}{
+		{"add", []string{"a", "b"}, "1:11", "1:29"},
+		{"", []string{"x"}, "2:16", "2:27"},
+		{"f", []string{}, "2:9", "2:29"},
+	}
+	fns := []*object.CompiledFunction{}
+	for _, c := range compiler.Bytecode().Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fns = append(fns, fn)
+		}
+	}
+	if len(fns) != len(expected) {
+		t.Fatalf("wrong number of functions. want=%d, got=%d", len(expected), len(fns))
+	}
+	for i, want := range expected {
+		fn := fns[i]
+		if fn.Name != want.name {
+			t.Errorf("fns[%d]: wrong name. want=%q, got=%q", i, want.name, fn.Name)
+		}
+		if strings.Join(fn.Parameters, ",") != strings.Join(want.params, ",") ||
+			fn.NumParameters != len(want.params) {
+			t.Errorf("fns[%d]: wrong parameters. want=%v, got=%v (%d)", i, want.params, fn.Parameters, fn.NumParameters)
+		}
+		if fn.Pos.String() != want.pos || fn.End.String() != want.end {
+			t.Errorf("fns[%d]: wrong span. want=%s-%s, got=%s-%s", i, want.pos, want.end, fn.Pos, fn.End)
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { 2 }`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpPop),
+				// 0004
+				code.Make(code.OpJump, 17),
+				// 0007, the catch handler
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpJump, 17),
+				// 0017, the value of the try
+				code.Make(code.OpNull),
+				// 0018
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `try { throw 1 } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpThrow),
+				// 0004
+				code.Make(code.OpConstant, 1),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 22),
+				// 0011, the finally handler
+				code.Make(code.OpSetGlobal, 0),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpGetGlobal, 0),
+				// 0021
+				code.Make(code.OpThrow),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestHandlerTable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.Handler
+	}{
+		{`try { 1 } catch (e) { 2 }`, []object.Handler{{Start: 0, End: 4, Target: 7}}},
+		{
+			`try { 1 } catch (e) { 2 } finally { 3 }`,
+			[]object.Handler{
+				{Start: 0, End: 4, Target: 11},
+				{Start: 0, End: 4, Target: 25},
+				{Start: 14, End: 18, Target: 25},
+			},
+		},
+		// the handler of the inner try come first
+		{
+			`try { try { 1 } catch (e) { 2 } } catch (e) { 3 }`,
+			[]object.Handler{
+				{Start: 0, End: 4, Target: 7},
+				{Start: 0, End: 19, Target: 22},
+			},
+		},
+		// the operands of the call stay on the stack
+		{
+			`puts(1, if (true) { try { 2 } catch (e) { 3 } })`,
+			[]object.Handler{{Start: 9, End: 13, Target: 16, Depth: 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		handlers := compiler.Bytecode().Handlers
+		if fmt.Sprint(handlers) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: wrong handlers. want=%v, got=%v", tt.input, tt.expected, handlers)
+		}
+	}
+}
+
 func TestFunctionCalls(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -952,7 +1514,7 @@ fn(a) {
 				},
 				[]code.Instructions{
 					// 参考 compiler的注释
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -988,15 +1550,15 @@ fn(a) {
 				},
 				[]code.Instructions{
 					// 中间这层函数看，a是free， 还有自己的local b
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					// 看这里的值要看上一层的 FreeSymbols 有多少个，生成指令的时候先离开上层的 scope，然后再遍历
 					// FreeSymbols，然后把 FreeSymbols的数量放在第三个参数上
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1051,8 +1613,8 @@ fn() {
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
 					//
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 4, 2),
 
 					code.Make(code.OpReturnValue),
@@ -1060,7 +1622,7 @@ fn() {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 5, 1),
 
 					code.Make(code.OpReturnValue),
@@ -1077,3 +1639,165 @@ fn() {
 
 	runCompilerTests(t, tests)
 }
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+let countDown = fn(x) { countDown(x - 1); };
+countDown(1);
+`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 局部函数互相调用，两个名字先定义再编译函数体
+			input: `
+let wrapper = fn() {
+  let even = fn() { odd(); };
+  let odd = fn() { even(); };
+  even();
+};
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 1),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// 内层闭包引用外层函数的名字
+			input: `
+let outer = fn() { fn() { outer; } };
+`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerErrorList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let fibonacci = fn(x) { fibonaci(x - 1) }; puts(fibonnaci(3)); y;",
+			[]string{
+				"1:25: undefined variable fibonaci; did you mean fibonacci?",
+				"1:49: undefined variable fibonnaci; did you mean fibonacci?",
+				"1:64: undefined variable y",
+			},
+		},
+		{
+			"let f = fn(count) { let g = fn() { cont + 1 }; break; }; lenn([]);",
+			[]string{
+				"1:36: undefined variable cont; did you mean count?",
+				"1:48: break outside loop",
+				"1:58: undefined variable lenn; did you mean len?",
+			},
+		},
+		{
+			"total = totl + 1;",
+			[]string{
+				"1:1: undefined variable total",
+				"1:9: undefined variable totl",
+			},
+		},
+		{
+			"let value = 1; let count = 2; valeu + conut;",
+			[]string{
+				"1:31: undefined variable valeu; did you mean value?",
+				"1:39: undefined variable conut; did you mean count?",
+			},
+		},
+		{
+			"let 日本語 = 1; 日本;",
+			[]string{"1:14: undefined variable 日本; did you mean 日本語?"},
+		},
+		{
+			"match (1) { item => item }; item;",
+			[]string{"1:29: undefined variable item"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		err := compiler.Compile(program)
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Fatalf("%s: error is not an ErrorList. got=%T (%v)", tt.input, err, err)
+		}
+		if len(errs) != len(tt.expected) {
+			t.Fatalf("%s: wrong number of errors. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+		for i, msg := range tt.expected {
+			if errs[i].Error() != msg {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, msg, errs[i])
+			}
+		}
+		if err.Error() != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong message. got=%q", tt.input, err)
+		}
+	}
+
+	if err := New().Compile(parse("1 + 2")); err != nil {
+		t.Errorf("expected no error, got=%v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"strings"
+)
+
+// Error is a compile error at the position of a node
+type Error struct {
+	Pos        token.Position
+	Msg        string
+	Suggestion string // a close name in scope, may be empty
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf("; did you mean %s?", e.Suggestion)
+	}
+	// 宏展开生成的节点没有位置
+	if !e.Pos.IsValid() {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Pos, msg)
+}
+
+// ErrorList is the errors of a compilation, in the order they are found
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Err return l as an error, nil when l is empty
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// errorf record an error at node, the compilation goes on
+func (c *Compiler) errorf(node ast.Node, format string, a ...interface{}) *Error {
+	err := &Error{Pos: node.Pos(), Msg: fmt.Sprintf(format, a...)}
+	c.errors = append(c.errors, err)
+	return err
+}
+
+// undefinedError record that name is not defined, suggesting a close name
+func (c *Compiler) undefinedError(ident *ast.Identifier) {
+	err := c.errorf(ident, "undefined variable %s", ident.Value)
+	err.Suggestion = c.symbolTable.Suggest(ident.Value)
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// the Levenshtein distance where swapping two adjacent letters, the most
+// common typo, is one edit. It count characters, not bytes.
+func editDistance(sa, sb string) int {
+	a, b := []rune(sa), []rune(sb)
+	// the rows i-2, i-1 and i of the table
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && prev2[j-2]+1 < cur[j] {
+				cur[j] = prev2[j-2] + 1
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
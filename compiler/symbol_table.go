@@ -1,5 +1,11 @@
 package compiler
 
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
 type SymbolScope string
 
 const (
@@ -7,6 +13,8 @@ const (
 	GlobalScope  SymbolScope = "GLOBAL"
 	BuiltinScope SymbolScope = "BUILTIN"
 	FreeScope    SymbolScope = "FREE"
+	// FunctionScope is the name of the function itself inside its body
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
@@ -55,6 +63,61 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return ret
 }
 
+// Declare return the symbol name already has in this table, or define it.
+// Used for globals: a name keep its slot when let again, so it can be
+// referenced before its let is compiled.
+func (s *SymbolTable) Declare(name string) Symbol {
+	symbol, ok := s.store[name]
+	if ok && symbol.Scope == GlobalScope {
+		return symbol
+	}
+	return s.Define(name)
+}
+
+// DeclareVariable return the variable name already has in this table, or
+// define it. The globals and the variables of outer functions are not
+// reused, a new local hide them.
+func (s *SymbolTable) DeclareVariable(name string) Symbol {
+	if s.Outer == nil {
+		return s.Declare(name)
+	}
+	if symbol, ok := s.store[name]; ok && symbol.Scope == LocalScope {
+		return symbol
+	}
+	return s.Define(name)
+}
+
+// GlobalNames return the names of the global slots, indexed by slot. A
+// slot whose name has been defined again is left empty.
+func (s *SymbolTable) GlobalNames() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
+
+// DefineScoped define name in a new slot that hide what name was until
+// the returned function is called
+func (s *SymbolTable) DefineScoped(name string) (Symbol, func()) {
+	outer, ok := s.store[name]
+	symbol := s.Define(name)
+	return symbol, func() {
+		if ok {
+			s.store[name] = outer
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+// Rebind make name refer to symbol again, symbol is a slot of this table
+func (s *SymbolTable) Rebind(symbol Symbol) {
+	s.store[symbol.Name] = symbol
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{
 		Name:  name,
@@ -66,6 +129,74 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
+// DefineFunctionName define the name of the function being compiled, it
+// does not take a local slot
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// ResolveVariable is Resolve but never give the function name, it find
+// the variable holding the function. Later Resolve give the variable too.
+func (s *SymbolTable) ResolveVariable(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok && !s.isFunctionName(obj) {
+		return obj, true
+	}
+	if s.Outer == nil {
+		return obj, ok
+	}
+	obj, ok = s.Outer.ResolveVariable(name)
+	if !ok || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+	if obj.Scope == GlobalScope {
+		s.store[name] = obj
+		return obj, ok
+	}
+	return s.defineFree(obj), true
+}
+
+// isFunctionName report whether sym is the function name, directly or
+// captured from an outer function
+func (s *SymbolTable) isFunctionName(sym Symbol) bool {
+	switch sym.Scope {
+	case FunctionScope:
+		return true
+	case FreeScope:
+		return s.Outer.isFunctionName(s.FreeSymbols[sym.Index])
+	}
+	return false
+}
+
+// Suggest return the name visible from s that is closest to name, for a
+// "did you mean", or "" when no name is close enough. Inner names win.
+func (s *SymbolTable) Suggest(name string) string {
+	length := utf8.RuneCountInString(name)
+	maxDistance := length / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	best, bestDistance := "", maxDistance+1
+	for t := s; t != nil; t = t.Outer {
+		names := make([]string, 0, len(t.store))
+		for n := range t.store {
+			// 隐藏的变量，比如 @match
+			if !strings.Contains(n, "@") {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if d := editDistance(name, n); d < bestDistance && d < length {
+				best, bestDistance = n, d
+			}
+		}
+	}
+	return best
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -330,3 +330,111 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+	ret, ok := local.Resolve("a")
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+	if ret != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, ret)
+	}
+
+	// the variable holding the function is still reachable for assignment
+	variable := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+	ret, ok = local.ResolveVariable("a")
+	if !ok || ret != variable {
+		t.Errorf("expected variable %s to resolve to %+v, got=%+v", variable.Name, variable, ret)
+	}
+}
+
+func TestShadowingFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("a")
+	local.Define("a")
+
+	expected := Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	ret, ok := local.Resolve("a")
+	if !ok {
+		t.Fatalf("name %s not resolvable", expected.Name)
+	}
+	if ret != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, ret)
+	}
+}
+
+func TestDeclareGlobal(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	a := global.Declare("a")
+	again := global.Declare("a")
+	if a != again {
+		t.Errorf("declare again changed the symbol. first=%+v, second=%+v", a, again)
+	}
+
+	// a global shadow the builtin
+	expected := Symbol{Name: "len", Scope: GlobalScope, Index: 1}
+	if ret := global.Declare("len"); ret != expected {
+		t.Errorf("expected len to be declared as %+v, got=%+v", expected, ret)
+	}
+
+	names := global.GlobalNames()
+	if len(names) != 2 || names[0] != "a" || names[1] != "len" {
+		t.Errorf("wrong global names. got=%v", names)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("fibonacci")
+	global.Define("counter")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("count")
+	local.Define("value")
+	local.Define("größe")
+	local.Define("日本語")
+	local.Define("@match")
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"fibonaci", "fibonacci"},
+		{"fibbonaci", "fibonacci"},
+		{"lenn", "len"},
+		// 里层的名字优先
+		{"coun", "count"},
+		{"countr", "count"},
+		{"counterr", "counter"},
+		// 相邻字母对调算一次编辑
+		{"conut", "count"},
+		{"valeu", "value"},
+		{"fibonacic", "fibonacci"},
+		{"eln", "len"},
+		// 按字符算，不按字节
+		{"grösse", "größe"},
+		{"gröse", "größe"},
+		{"日本", "日本語"},
+		{"本日語", "日本語"},
+		{"x", ""},
+		{"match", ""},
+		{"totally", ""},
+	}
+
+	for _, tt := range tests {
+		if got := local.Suggest(tt.name); got != tt.expected {
+			t.Errorf("Suggest(%q) wrong. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// tryContext is a try statement whose block or catch is being compiled
+type tryContext struct {
+	finally *ast.BlockStatement // nil without finally
+	// the instructions raising into the handlers of the try, the last
+	// range start at start and is still open
+	ranges [][2]int
+	start  int
+}
+
+// keep record that the value just compiled stay on the stack while the
+// next operands are compiled
+func (c *Compiler) keep() {
+	c.scopes[c.scopeIndex].depth++
+}
+
+func (c *Compiler) enterTry(finally *ast.BlockStatement) *tryContext {
+	try := &tryContext{finally: finally, start: len(c.currentInstruction())}
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, try)
+	return try
+}
+
+// leaveTry close the ranges of the innermost try and return them
+func (c *Compiler) leaveTry() [][2]int {
+	scope := &c.scopes[c.scopeIndex]
+	try := scope.tries[len(scope.tries)-1]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	c.pauseTry(try)
+	return try.ranges
+}
+
+// pauseTry close the open range of try, the instructions that follow do
+// not raise into its handlers
+func (c *Compiler) pauseTry(try *tryContext) {
+	end := len(c.currentInstruction())
+	if try.start < end {
+		try.ranges = append(try.ranges, [2]int{try.start, end})
+	}
+	try.start = end
+}
+
+// exitTries compile the finally of the tries left by a return, break or
+// continue, the tries from the innermost down to the n-th. The finally
+// of a try is not covered by its own handlers but by the outer ones.
+func (c *Compiler) exitTries(n int) {
+	tries := c.scopes[c.scopeIndex].tries
+	for i := len(tries) - 1; i >= n; i-- {
+		c.pauseTry(tries[i])
+		if tries[i].finally == nil {
+			continue
+		}
+		// 在 finally 里再 return 只会经过外层的 try
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		c.compileCopy(tries[i].finally)
+	}
+	c.scopes[c.scopeIndex].tries = tries
+	for _, try := range tries[n:] {
+		try.start = len(c.currentInstruction())
+	}
+}
+
+// compileCopy compile a block compiled somewhere else too, its errors are
+// only reported once
+func (c *Compiler) compileCopy(block *ast.BlockStatement) {
+	numErrors := len(c.errors)
+	c.compile(block)
+	c.errors = c.errors[:numErrors]
+}
+
+// addHandlers add a handler for each range, jumping to the current position
+func (c *Compiler) addHandlers(ranges [][2]int, depth int) {
+	scope := &c.scopes[c.scopeIndex]
+	target := len(scope.instructions)
+	for _, r := range ranges {
+		scope.handlers = append(scope.handlers, object.Handler{
+			Start:  r[0],
+			End:    r[1],
+			Target: target,
+			Depth:  depth,
+		})
+	}
+}
+
+// compileTryStatement compile the blocks then the handlers, the finally
+// is compiled again on every way out of the try.
+// overview:
+// 1.block / 2.finally / 3.jump to 8 /
+// 4.catch handler: store the exception / 5.catch / 6.finally / 7.jump to 8 /
+// 8.finally handler: save the exception, finally, throw it again /
+// 9.null as the value of the try
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	depth := c.scopes[c.scopeIndex].depth
+
+	c.enterTry(node.Finally)
+	err := c.compile(node.Block)
+	blockRanges := c.leaveTry()
+	if err != nil {
+		return err
+	}
+	endJumps := []int{}
+	if node.Finally != nil {
+		err := c.compile(node.Finally)
+		if err != nil {
+			return err
+		}
+	}
+	endJumps = append(endJumps, c.emit(code.OpJump, Magic))
+
+	catchRanges := [][2]int{}
+	if node.Catch != nil {
+		c.addHandlers(blockRanges, depth)
+		// the parameter has its own slot, seen only by the catch block
+		param, restore := c.symbolTable.DefineScoped(node.Param.Value)
+		c.storeSymbol(&param)
+
+		c.enterTry(node.Finally)
+		err := c.compile(node.Catch)
+		catchRanges = c.leaveTry()
+		restore()
+		if err != nil {
+			return err
+		}
+		if node.Finally != nil {
+			c.compileCopy(node.Finally)
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, Magic))
+	}
+
+	if node.Finally != nil {
+		c.addHandlers(append(blockRanges, catchRanges...), depth)
+		exception := c.symbolTable.Define(fmt.Sprintf("@exception%d", len(c.scopes[c.scopeIndex].tries)))
+		c.storeSymbol(&exception)
+		c.compileCopy(node.Finally)
+		c.loadSymbol(&exception)
+		c.emit(code.OpThrow)
+	}
+
+	afterTryPos := len(c.currentInstruction())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterTryPos)
+	}
+	c.popNull()
+
+	return nil
+}
@@ -2,14 +2,18 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -23,19 +27,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.ReturnStatement:
 		// fmt.Println("return exec...")
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return throwError(val)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
 	// Statement ==> ExpressionStatement ==> IntegerLiteral
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	// Statement ==> ExpressionStatement ==> Boolean
@@ -43,19 +65,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		// fmt.Println("infix calculation")
 		// fmt.Println(node.String())
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
 		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
 		// fmt.Println("if expression exec...")
 		return evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -66,38 +99,50 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			Parameters: params,
 			Env:        env,
 			Body:       body,
+			Name:       node.Name,
 		}
+	case *ast.MacroLiteral:
+		return newError("macro must be bound by a top-level let")
 	case *ast.CallExpression:
+		// quote的参数不求值
+		if isCallTo(node, "quote") {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote. got=%d, want=1", len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		// first evaluate the parameters
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 		return applyFunction(function, args)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	} // case end
 
 	return nil
@@ -118,11 +163,14 @@ func evalProgram(prog *ast.Program, env *object.Environment) object.Object {
 	for _, curStmt := range prog.Statements {
 		ret = Eval(curStmt, env)
 
+		if isError(ret) {
+			return ret
+		}
 		switch ret := ret.(type) {
 		case *object.ReturnValue:
 			return ret.Value
-		case *object.Error:
-			return ret
+		case *object.Break, *object.Continue:
+			return loopControlError(ret)
 		}
 		// if rv, ok := ret.(*object.ReturnValue); ok {
 		// 	return rv.Value
@@ -138,6 +186,8 @@ func evalPrefixExpression(op string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitNotPrefixOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s%s", op, right.Type())
 	}
@@ -157,17 +207,40 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NewBigInt(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.NewBigInt(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+}
+
+func evalBitNotPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return object.NewBigInt(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
 }
 
 func evalInfixExpression(op string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(op, left, right)
+	case object.IsInteger(left) && object.IsInteger(right):
+		return evalBigIntInfixExpression(op, object.ToBigInt(left), object.ToBigInt(right))
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(op, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(op, left, right)
 	case op == "==":
@@ -181,22 +254,55 @@ func evalInfixExpression(op string, left, right object.Object) object.Object {
 	}
 }
 
+// evalLogicalExpression short-circuit && and ||, the result is the last
+// evaluated operand
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		return left
+	}
+	return Eval(node.Right, env)
+}
+
 func evalIntegerInfixExpression(op string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
+	var ret int64
+	ok := true
 	switch op {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		ret, ok = object.AddInt64(leftVal, rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		ret, ok = object.SubInt64(leftVal, rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		ret, ok = object.MulInt64(leftVal, rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		ret, ok = object.DivInt64(leftVal, rightVal)
+	case "%":
+		ret, ok = object.ModInt64(leftVal, rightVal)
+	case "**":
+		ret, ok = object.PowInt64(leftVal, rightVal)
+	case "&":
+		ret = leftVal & rightVal
+	case "|":
+		ret = leftVal | rightVal
+	case "^":
+		ret = leftVal ^ rightVal
+	case "<<":
+		ret, ok = object.ShlInt64(leftVal, rightVal)
+	case ">>":
+		ret, ok = object.ShrInt64(leftVal, rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -204,11 +310,116 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
 	}
+	// overflow or edge case (division by zero, negative exponent...),
+	// redo it with big integers
+	if !ok {
+		return evalBigIntInfixExpression(op, big.NewInt(leftVal), big.NewInt(rightVal))
+	}
+	return &object.Integer{Value: ret}
+}
+
+func evalBigIntInfixExpression(op string, left, right *big.Int) object.Object {
+	var ret object.Object
+	var err error
+	switch op {
+	case "+":
+		ret = object.NewBigInt(new(big.Int).Add(left, right))
+	case "-":
+		ret = object.NewBigInt(new(big.Int).Sub(left, right))
+	case "*":
+		ret = object.NewBigInt(new(big.Int).Mul(left, right))
+	case "/":
+		ret, err = object.DivBigInt(left, right)
+	case "%":
+		ret, err = object.ModBigInt(left, right)
+	case "**":
+		ret, err = object.PowBigInt(left, right)
+	case "&":
+		ret = object.NewBigInt(new(big.Int).And(left, right))
+	case "|":
+		ret = object.NewBigInt(new(big.Int).Or(left, right))
+	case "^":
+		ret = object.NewBigInt(new(big.Int).Xor(left, right))
+	case "<<":
+		ret, err = object.ShlBigInt(left, right)
+	case ">>":
+		ret, err = object.ShrBigInt(left, right)
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Cmp(right) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Cmp(right) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", object.BIGINT_OBJ, op, object.BIGINT_OBJ)
+	}
+	if err != nil {
+		return newError("%s", err)
+	}
+	return ret
+}
+
+func evalFloatInfixExpression(op string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch op {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+// isNumber report whether obj is an integer or a float
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat convert a number to float64, integers are promoted
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		return object.BigIntToFloat(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -219,6 +430,42 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return NULL
 	}
 }
+
+// evalMatchExpression evaluate the body of the first matching arm, NULL
+// when none match
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	value := Eval(me.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+	for _, arm := range me.Arms {
+		pattern, err := object.NewMatchPattern(arm.Pattern)
+		if err != nil {
+			return newError("%s", err)
+		}
+		values, ok := pattern.Match(value)
+		if !ok {
+			continue
+		}
+		// the bindings are seen only by the guard and body of the arm
+		armEnv := object.NewEnclosedEnvironment(env)
+		for i, name := range pattern.Bindings {
+			armEnv.Set(name, values[i])
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return NULL
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -232,13 +479,80 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+		if ret, done := evalLoopBody(ws.Body, env); done {
+			return ret
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	iterator, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("not iterable: %s", iterable.Type())
+	}
+	for {
+		el, ok := iterator.Next()
+		if !ok {
+			return NULL
+		}
+		env.Set(fs.Variable.Value, el)
+		if ret, done := evalLoopBody(fs.Body, env); done {
+			return ret
+		}
+	}
+}
+
+// evalLoopBody run one iteration, done is true when the loop must stop
+// with ret as its result
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (ret object.Object, done bool) {
+	ret = Eval(body, env)
+	if ret == nil {
+		return nil, false
+	}
+	if isError(ret) {
+		return ret, true
+	}
+	switch ret.Type() {
+	case object.RETURN_VALUE_OBJ:
+		return ret, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	default:
+		return nil, false
+	}
+}
+
+func isLoopControl(obj object.Object) bool {
+	return obj == BREAK || obj == CONTINUE
+}
+
+// loopControlError is the error for a break or continue reaching a
+// function or the program without meeting a loop
+func loopControlError(obj object.Object) *object.Error {
+	return newError("%s outside loop", obj.Inspect())
+}
+
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var ret object.Object
 	for _, stmt := range block.Statements {
 		ret = Eval(stmt, env)
 		if ret != nil {
 			rt := ret.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || isError(ret) ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return ret
 			}
 		}
@@ -253,17 +567,63 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{
 		Message: fmt.Sprintf(format, a...),
+		Kind:    object.RUNTIME_ERROR,
 	}
 }
 
+// isError report whether obj is an error being raised, a caught error is a
+// plain value
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		return obj.Type() == object.ERROR_OBJ && !obj.(*object.Error).Caught
 	}
 
 	return false
 }
 
+// isAbrupt report whether obj end the evaluation of the enclosing
+// expressions: an error raised, a return, a break or a continue
+func isAbrupt(obj object.Object) bool {
+	return isError(obj) || isLoopControl(obj) || obj != nil && obj.Type() == object.RETURN_VALUE_OBJ
+}
+
+// throwError return the error raising value, an error raised again keep
+// its message
+func throwError(value object.Object) *object.Error {
+	if err, ok := value.(*object.Error); ok {
+		return &object.Error{Message: err.Message, Kind: err.Kind, Value: err.Value}
+	}
+	return &object.Error{Message: "uncaught exception: " + value.Inspect(), Value: value}
+}
+
+// evalTryStatement run the block, then the catch when an error is raised,
+// then the finally. A return, break, continue or error out of the finally
+// replace the one of the block or catch.
+func evalTryStatement(ts *ast.TryStatement, env *object.Environment) object.Object {
+	ret := Eval(ts.Block, env)
+	if isError(ret) && ts.Catch != nil {
+		err := ret.(*object.Error)
+		var exception object.Object = err.Catch()
+		if err.Value != nil {
+			exception = err.Value
+		}
+		// the parameter is seen only by the catch block
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(ts.Param.Value, exception)
+		ret = Eval(ts.Catch, catchEnv)
+	}
+	if ts.Finally != nil {
+		fin := Eval(ts.Finally, env)
+		if isAbrupt(fin) {
+			return fin
+		}
+	}
+	if isAbrupt(ret) {
+		return ret
+	}
+	return NULL
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
@@ -273,14 +633,14 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var ret []object.Object
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
@@ -293,11 +653,24 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			if fn.Name != "" {
+				return newError("wrong number of arguments to %s: want=%d, got=%d", fn.Name, len(fn.Parameters), len(args))
+			}
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+		if isLoopControl(evaluated) {
+			return loopControlError(evaluated)
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if ret := fn.Fn(args...); ret != nil {
+		ret, err := fn.Call(args...)
+		if err != nil {
+			return err
+		}
+		if ret != nil {
 			return ret
 		}
 		return NULL
@@ -337,6 +710,13 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.Error).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -353,11 +733,73 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	ch, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+
+	return ch
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if ident, ok := node.Target.(*ast.Identifier); ok {
+		value := Eval(node.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+		if _, ok := env.Assign(ident.Value, value); !ok {
+			if _, ok := builtins[ident.Value]; ok {
+				return newError("cannot assign to builtin %s", ident.Value)
+			}
+			return newError("identifier not found: %s", ident.Value)
+		}
+		return value
+	}
+	target, ok := node.Target.(*ast.IndexExpression)
+	if !ok {
+		return newError("invalid assignment target %s", node.Target.String())
+	}
+	left := Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d (length %d)", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return value
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
@@ -365,7 +807,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
@@ -35,6 +35,105 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalIntegerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"2 ** -1", 0.5},
+		{"2 ** 64", "18446744073709551616"},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 << 64", "18446744073709551616"},
+		{"(1 << 64) >> 63", 2},
+		{"1 | 2 ^ 3 & 4 << 1", 3},
+		{"5.5 % 2", 1.5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			result, ok := evaluated.(*object.Float)
+			if !ok || result.Value != expected {
+				t.Errorf("%s: expected float %g, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case string:
+			if evaluated.Type() != object.BIGINT_OBJ || evaluated.Inspect() != expected {
+				t.Errorf("%s: expected big integer %s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-1.5", -1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"1e3 + 2.5e-1", 1000.25},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("object is not float. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("object has wrong value. got=%g, want=%g", result.Value, tt.expected)
+		}
+	}
+}
+
+func TestEvalBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{`
+let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+fact(25)`, "15511210043330985984000000"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("object has wrong value. got=%s, want=%s", result.Inspect(), tt.expected)
+		}
+	}
+
+	// demoted back to Integer as soon as it fits
+	testIntegerObject(t, testEval("9223372036854775807 + 1 - 1"), 9223372036854775807)
+	testBoleanObject(t, testEval("9223372036854775807 + 1 > 9223372036854775807"), true)
+	testIntegerObject(t, testEval(`{9223372036854775807 + 1: 5}[9223372036854775806 + 2]`), 5)
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -90,6 +189,38 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalAndComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1", false},
+		{"true && false", false},
+		{"false || true", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 < 3", true},
+		{"1 && 2", 2},
+		{"0 || 5", 0},
+		{"false || 5", 5},
+		// short-circuit, the right side would fail
+		{"false && 1()", false},
+		{"true || 1()", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBoleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		}
+	}
+}
+
 func testBoleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	ret, ok := obj.(*object.Boolean)
 	if !ok {
@@ -261,6 +392,30 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"1 % 0",
+			"modulo by zero",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"wrong number of arguments to add: want=2, got=1",
+		},
+		{
+			"fn(a) { a }(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -280,6 +435,380 @@ if (10 > 1) {
 	}
 }
 
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+let first = fn(arr) { for (x in arr) { if (x % 2 == 0) { return x; } } -1 };
+first([1, 3, 4, 5])`, 4},
+		{`
+let first = fn(arr) { for (x in arr) { if (x % 2 == 0) { return x; } } -1 };
+first([1, 3])`, -1},
+		{`
+let f = fn() { for (x in [1, 2, 3, 4]) { if (x < 3) { continue; } return x; } };
+f()`, 3},
+		{`
+let f = fn() { for (x in [1, 2, 3]) { if (x == 1) { break; } return 99; } 7 };
+f()`, 7},
+		{`let f = fn() { while (true) { break; } 5 }; f()`, 5},
+		{`let f = fn() { while (false) { 1 } }; f()`, nil},
+		{`
+let f = fn() {
+  for (a in [1, 2, 3]) {
+    for (b in [1, 2, 3]) { if (b > 1) { break; } }
+    if (a == 3) { return a * 10; }
+  }
+};
+f()`, 30},
+		{`
+let f = fn() { for (c in "日本") { return c; } };
+f()`, "日"},
+		{`
+let f = fn() { for (k in {3: "c", 1: "a", 2: "b"}) { return k; } };
+f()`, 1},
+		{`for (x in [1, 2]) { if (x == 2) { break; } } x`, 2},
+		// the loop variable reuse a variable of the same scope
+		{`let x = 5; let f = fn() { x }; for (x in [1, 2]) { }; x + f() * 10`, 22},
+		{`let g = fn() { let x = 5; let f = fn() { x }; for (x in [1, 2]) { }; x + f() * 10 }; g()`, 22},
+		{`let x = 5; let g = fn() { for (x in [1, 2]) { }; x }; g() + x * 10`, 52},
+		// a loop has no value
+		{`for (x in [1]) { }`, nil},
+		{`let i = 0; while (i < 1) { i = i + 1 }`, nil},
+		// break, continue and return inside an expression leave its operands
+		{`
+let i = 0; let s = 0;
+while (i < 5000) { i = i + 1; let y = 1 + if (i % 2 == 0) { continue; } else { 2 }; s = s + y };
+s`, 7500},
+		{`let s = 0; for (x in [1, 2, 3]) { s = s + [x, if (x == 2) { break; } else { x }][1] }; s`, 1},
+		{`let f = fn(x) { 1 + if (x) { return 10 } else { 2 } }; f(true) + f(false)`, 13},
+		{"for (x in 1) { }", errorMessage("not iterable: INTEGER")},
+		{"break;", errorMessage("break outside loop")},
+		{"while (true) { fn() { continue; }() }", errorMessage("continue outside loop")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected string %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+type errorMessage string
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let r = 0; try { throw 1 } catch (e) { r = e } r`, 1},
+		{`let r = ""; try { 1 / 0 } catch (e) { r = e["type"] + ": " + e["message"] } r`, "RuntimeError: division by zero"},
+		{`let r = ""; try { len(1) } catch (e) { r = e["type"] + ": " + e["message"] } r`, "BuiltinError: argument to `len` not supported, got=INTEGER"},
+		{`let r = ""; try { 1 / 0 } catch (e) { r = first([e])["message"] } r`, "division by zero"},
+		{`let r = 0; try { r = 1 } finally { r = r + 10 } r`, 11},
+		{`
+let f = fn() { throw "boom" };
+let g = fn() { f() + 1 };
+let r = "";
+try { g() } catch (e) { r = e }
+r`, "boom"},
+		{`
+let n = 0;
+let f = fn() { try { return 1 } finally { n = 10 } };
+f() + n`, 11},
+		{`
+let f = fn(x) { try { throw x } catch (e) { return e * 2 } };
+1 + f(3)`, 7},
+		{`
+let n = 0;
+for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n = n + 1 } }
+n`, 2},
+		{`
+let r = "";
+try { try { throw "a" } finally { r = r + "f" } } catch (e) { r = r + e }
+r`, "fa"},
+		{`
+let r = "";
+try { try { throw "a" } catch (e) { throw e + "b" } finally { r = r + "f" } } catch (e) { r = r + e }
+r`, "fab"},
+		{`let a = [10, if (true) { try { [20, 1 / 0] } catch (e) { } 30 }]; a[0] + a[1]`, 40},
+		{`let add = fn(a, b) { a + b }; add(1, if (true) { try { throw 5 } catch (e) { } 2 })`, 3},
+		{`let f = fn() { try { throw 1 } finally { return 2 } }; f()`, 2},
+		// the parameter is seen only by the catch block
+		{`let f = fn() { let e = 7; try { throw 1 } catch (e) { e } e }; f()`, 7},
+		{`let e = 7; try { throw 1 } catch (e) { e }; e`, 7},
+		{`let f = 0; try { throw 3 } catch (e) { f = fn() { e } }; f()`, 3},
+		// a try has no value
+		{`try { throw "x" } catch (e) { e }`, nil},
+		{`try { 1 } finally { 2 }`, nil},
+		{`throw "boom"`, errorMessage("uncaught exception: boom")},
+		{`try { 1 / 0 } catch (e) { throw e }`, errorMessage("division by zero")},
+		{`try { throw 1 } finally { 2 }`, errorMessage("uncaught exception: 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected string %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 0 => "zero", 1 => "one", _ => "many" }`, "one"},
+		{`match (5) { 0 => "zero", 1 => "one", _ => "many" }`, "many"},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match (2.0) { 2 => "two", _ => "other" }`, "two"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (3) { 1 => 1 }`, nil},
+		{`match (7) { n => n * 2 }`, 14},
+		{`match (7) { n if n > 10 => 1, n if n > 5 => 2, _ => 3 }`, 2},
+		{`match ([1, 2]) { [] => 0, [x] => x, [x, y] => x + y }`, 3},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b * c }`, 7},
+		{`match ([1, 2, 3]) { [1, _] => 0, [1, _, z] => z }`, 3},
+		{`match ({"op": "add", "x": 1, "y": 2}) { {"op": "sub"} => 0, {"op": "add", "x": a, "y": b} => a + b }`, 3},
+		{`match ({"x": 1}) { {"y": y} => y, _ => -1 }`, -1},
+		{`match ("x") { [a] => a, {"k": v} => v, _ => 9 }`, 9},
+		{`let f = fn(v) { match (v) { [h, t] if h == 0 => t, [h, t] => f(t) + h, _ => 0 } }; f([1, [2, [0, 5]]])`, 8},
+		// the bindings do not leak out of their arm
+		{`let x = 10; match (5) { x if x > 100 => "big", _ => "small" }; x`, 10},
+		{`let x = 10; match (5) { x => x }; x`, 10},
+		{`let f = fn() { let x = 10; match (5) { x if x > 100 => 1, _ => 2 }; x }; f()`, 10},
+		{`let f = match (5) { x => fn() { x } }; let x = 1; f()`, 5},
+		{`match (1) { y => y }; y`, errorMessage("identifier not found: y")},
+		{`if (false) { 1 } else if (false) { 2 } else if (true) { 3 } else { 4 }`, 3},
+		{`if (false) { 1 } else if (false) { 2 }`, nil},
+		{`let x = 5; if (x < 0) { "neg" } else if (x == 0) { "zero" } else { "pos" }`, "pos"},
+		{`match (1) { [x, x] => x }`, errorMessage("x bound more than once in pattern")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected string %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let c = 0; let inc = fn() { c = c + 1 }; inc(); inc(); c`, 2},
+		{`let x = 1; x = x + 1; x = x * 10`, 20},
+		{`
+let counter = fn() {
+  let c = 0;
+  fn() { c = c + 1; c }
+};
+let a = counter();
+let b = counter();
+a(); a();
+b();
+a() * 10 + b()`, 32},
+		// two closures share the captured variable with the defining function
+		{`
+let pair = fn() {
+  let n = 0;
+  let inc = fn() { n = n + 1 };
+  let get = fn() { n };
+  inc();
+  n = n + 10;
+  inc();
+  [get(), n]
+};
+let r = pair();
+r[0] * 100 + r[1]`, 1212},
+		// the variable is still shared once the function returned
+		{`
+let make = fn() {
+  let n = 0;
+  [fn() { n = n + 1 }, fn() { n }]
+};
+let fs = make();
+fs[0](); fs[0]();
+fs[1]()`, 2},
+		// captured through an intermediate function
+		{`
+let outer = fn() {
+  let n = 1;
+  let middle = fn() { fn() { n = n * 3 } };
+  middle()();
+  n
+};
+outer()`, 3},
+		{`
+let sum = fn(arr) {
+  let total = 0;
+  for (x in arr) { total = total + x; }
+  total
+};
+sum([1, 2, 3, 4])`, 10},
+		{`
+let count = fn(n) {
+  let i = 0;
+  while (i < n) { i = i + 1; }
+  i
+};
+count(5000)`, 5000},
+		// recursive local function see its own binding
+		{`
+let f = fn() {
+  let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+  fact(5)
+};
+f()`, 120},
+		// mutually recursive local functions
+		{`
+let parity = fn(n) {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+  even(n)
+};
+parity(10)`, true},
+		{`
+let parity = fn(n) {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let k = 1;
+  let odd = fn(n) { if (n == 0) { false } else { even(n - k) } };
+  even(n)
+};
+parity(7)`, false},
+		{`
+let f = fn() {
+  let h = fn() { 1 };
+  let g = fn() { h() };
+  let a = g();
+  let h = fn() { 2 };
+  a * 10 + g()
+};
+f()`, 12},
+		{`
+let f = fn() {
+  let a = fn(n) { if (n == 0) { 0 } else { b(n) } };
+  let b = fn(n) { c(n) + 1 };
+  let c = fn(n) { a(n - 1) };
+  a(4)
+};
+f()`, 4},
+		// the helpers outlive the function defining them
+		{`
+let make = fn() {
+  let ping = fn(n) { if (n == 0) { "ping" } else { pong(n - 1) } };
+  let pong = fn(n) { if (n == 0) { "pong" } else { ping(n - 1) } };
+  ping
+};
+make()(3)`, "pong"},
+		// a closure inside the function refer to the function by name
+		{`
+let sum = fn(n) { if (n == 0) { 0 } else { let g = fn() { sum(n - 1) }; n + g() } };
+sum(4)`, 10},
+		// assigning the name change the variable, not the running function
+		{`
+let f = fn() { f = 5; 1 };
+f() + f`, 6},
+		{"y = 1", errorMessage("identifier not found: y")},
+		{"len = 1", errorMessage("cannot assign to builtin len")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBoleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected string %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[1] = 5; a[0] + a[1] + a[2]", 9},
+		{"let a = [1, 2, 3]; a[0] = a[2] = 7; a[0] + a[2]", 14},
+		{"let a = [1, 2, 3]; a[1] = 5", 5},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{"let a = [1, 2]; a[2] = 0", errorMessage("index out of range: 2 (length 2)")},
+		{`let a = [1, 2]; a["x"] = 0`, errorMessage("array index must be INTEGER, got STRING")},
+		{"let h = {}; h[[1]] = 0", errorMessage("unusable as hash key: ARRAY")},
+		{`let s = "abc"; s[0] = "x"`, errorMessage("index assignment not supported: STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -315,6 +844,24 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fibonacci = fn(x) { x }; fibonacci", "<fn fibonacci(x)>"},
+		{"fn(a, b) { a + b }", "<fn(a, b)>"},
+		{"let f = fn() { 1 }; [f]", "[<fn f()>]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -389,6 +936,35 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"héllo"[1]`, "é"},
+		{`"λx"[0]`, "λ"},
+		{`"λx"[2]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -397,6 +973,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("λ>> ")`, 4},
+		{`len("日本語")`, 3},
 		{`len(1)`, "argument to `len` not supported, got=INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		// array
@@ -583,6 +1161,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{5: 5}[5]`,
 			5,
 		},
+		{
+			`{5: 5}[5.0]`,
+			5,
+		},
+		{
+			`{5.0: 5}[5]`,
+			5,
+		},
+		{
+			`{0.5: 5}[0.5]`,
+			5,
+		},
 		{
 			`{true: 5}[true]`,
 			5,
@@ -603,3 +1193,66 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestBuiltinErrorValues(t *testing.T) {
+	// 测试用的内置函数，返回的错误给脚本看
+	check := registerTestBuiltin(t, "check", func(args ...object.Object) object.Object {
+		if args[0] == TRUE {
+			return TRUE
+		}
+		return &object.Error{Message: "check failed", Kind: object.BUILTIN_ERROR}
+	})
+	check.ErrorValues = true
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`check(true)`, true},
+		{`check(false)["message"]`, "check failed"},
+		{`let e = check(false); len([e, e])`, 2},
+		{`let r = "none"; try { check(false) } catch (e) { r = "caught" } r`, "none"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBoleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected string %q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestSharedBuiltinError(t *testing.T) {
+	// 每次返回同一个错误，捕获它不能改掉它
+	failed := &object.Error{Message: "failed", Kind: object.BUILTIN_ERROR}
+	registerTestBuiltin(t, "fail", func(args ...object.Object) object.Object { return failed })
+
+	evaluated := testEval(`let r = ""; try { fail() } catch (e) { r = e["message"] } r`)
+	if str, ok := evaluated.(*object.String); !ok || str.Value != "failed" {
+		t.Errorf("expected string %q, got=%s", "failed", evaluated.Inspect())
+	}
+	evaluated = testEval(`try { fail() } catch (e) { }; fail(); 42`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "failed" {
+		t.Errorf("expected error %q, got=%s", "failed", evaluated.Inspect())
+	}
+	if failed.Caught {
+		t.Errorf("the error returned by the builtin was changed")
+	}
+}
+
+// registerTestBuiltin add a builtin to builtins until the test ends
+func registerTestBuiltin(t *testing.T, name string, fn object.BuiltinFunction) *object.Builtin {
+	t.Helper()
+	builtin := &object.Builtin{Name: name, Fn: fn}
+	builtins[name] = builtin
+	t.Cleanup(func() { delete(builtins, name) })
+	return builtin
+}
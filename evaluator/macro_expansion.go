@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// MaxExpansionDepth bound the rounds of expansion, a macro expanding into
+// a call to itself would never stop
+const MaxExpansionDepth = 100
+
+// DefineMacros move the top-level `let name = macro(...) {...}` of the
+// program into env
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if let, ok := isMacroDefinition(stmt); ok {
+			addMacro(let, env)
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+	program.Statements = statements
+}
+
+func isMacroDefinition(stmt ast.Statement) (*ast.LetStatement, bool) {
+	let, ok := stmt.(*ast.LetStatement)
+	if !ok || let == nil {
+		return nil, false
+	}
+	_, ok = let.Value.(*ast.MacroLiteral)
+	return let, ok
+}
+
+func addMacro(let *ast.LetStatement, env *object.Environment) {
+	lit := let.Value.(*ast.MacroLiteral)
+	macro := &object.Macro{
+		Parameters: lit.Parameters,
+		Body:       lit.Body,
+		Env:        env,
+	}
+	env.Set(let.Name.Value, macro)
+}
+
+// ExpandMacros return the program with the calls to the macros of env
+// replaced by their expansion. The arguments are given to the macro
+// quoted, the macro must return a quote.
+func ExpandMacros(program *ast.Program, env *object.Environment) (*ast.Program, error) {
+	for depth := 0; depth < MaxExpansionDepth; depth++ {
+		expanded := false
+		var err error
+		node := ast.Modify(program, func(node ast.Node) ast.Node {
+			call, ok := node.(*ast.CallExpression)
+			if !ok || err != nil {
+				return node
+			}
+			macro, name, ok := isMacroCall(call, env)
+			if !ok {
+				return node
+			}
+			expanded = true
+
+			ret, expandErr := expandMacroCall(macro, name, call)
+			if expandErr != nil {
+				err = expandErr
+				return node
+			}
+			return ret
+		})
+		if err != nil {
+			return nil, err
+		}
+		program = node.(*ast.Program)
+		// 展开的结果里可能还有宏调用，再来一轮
+		if !expanded {
+			return program, nil
+		}
+	}
+	return nil, fmt.Errorf("macro expansion too deep, more than %d rounds", MaxExpansionDepth)
+}
+
+func isMacroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, string, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, "", false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, "", false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ident.Value, ok
+}
+
+func expandMacroCall(macro *object.Macro, name string, call *ast.CallExpression) (ast.Node, error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, fmt.Errorf("%s: wrong number of arguments to macro %s: want=%d, got=%d",
+			call.Pos(), name, len(macro.Parameters), len(call.Arguments))
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for i, param := range macro.Parameters {
+		env.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+	}
+
+	evaluated := unwrapReturnValue(Eval(macro.Body, env))
+	switch evaluated := evaluated.(type) {
+	case *object.Quote:
+		return evaluated.Node, nil
+	case *object.Error:
+		return nil, fmt.Errorf("%s: macro %s: %s", call.Pos(), name, evaluated.Message)
+	default:
+		return nil, fmt.Errorf("%s: macro %s must return a quote, got %s", call.Pos(), name, typeOf(evaluated))
+	}
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
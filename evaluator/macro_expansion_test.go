@@ -0,0 +1,197 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };
+`
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("body is not %q. got=%q", "(x + y)", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+let infixExpression = macro() { quote(1 + 2); };
+infixExpression();
+`,
+			`(1 + 2)`,
+		},
+		{
+			`
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+reverse(2 + 2, 10 - 5);
+`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) {
+        unquote(consequence);
+    } else {
+        unquote(alternative);
+    });
+};
+unless(10 > 5, puts("not greater"), puts("greater"));
+`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			// an expansion may call another macro
+			`
+let double = macro(x) { quote(unquote(x) * 2); };
+let quadruple = macro(x) { quote(double(double(unquote(x)))); };
+quadruple(a);
+`,
+			`((a * 2) * 2)`,
+		},
+		{
+			// the macro body is not consumed by an expansion
+			`
+let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+twice(1); twice(2);
+`,
+			`(1 + 1); (2 + 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`
+let plusOne = macro(x) {
+    quote(fn() { let tmp = 1; unquote(x) + tmp }());
+};
+let tmp = 10;
+plusOne(tmp)
+`, "11"},
+		{`
+let rescue = macro(x) {
+    quote(fn() { let r = 0; try { throw 1 } catch (e) { r = unquote(x) }; r }());
+};
+let e = 10;
+rescue(e)
+`, "10"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("the macro captured the user variable. want=%s, got=%s", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let m = macro(x) { quote(x) }; m(1, 2)",
+			"1:32: wrong number of arguments to macro m: want=1, got=2",
+		},
+		{
+			"let m = macro(x) { 1 }; m(1)",
+			"1:25: macro m must return a quote, got INTEGER",
+		},
+		{
+			"let m = macro(x) { y }; m(1)",
+			"1:25: macro m: identifier not found: y",
+		},
+		{
+			"let m = macro(x) { quote(m(unquote(x))) }; m(1)",
+			"macro expansion too deep, more than 100 rounds",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Fatalf("%s: expected expansion error but got none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+	"sync/atomic"
+)
+
+// gensym number the names generated for hygiene, macros may be expanded
+// by several goroutines
+var gensym int64
+
+// quote return its argument unevaluated, except the unquote() calls which
+// are evaluated and spliced in. The names bound by the quoted code are
+// renamed so they can't capture the variables of the code unquoted into
+// it, or of the code the macro is expanded into.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	// 1. 先把unquote换成占位的名字，改名时不碰它们
+	unquotes := []*ast.CallExpression{}
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") {
+			return node
+		}
+		unquotes = append(unquotes, call)
+		return placeholder(len(unquotes) - 1)
+	})
+
+	// 2. 找出quote里绑定的名字
+	renames := map[string]string{}
+	ast.Inspect(node, func(node ast.Node) bool {
+		for _, name := range boundNames(node) {
+			if _, ok := renames[name]; !ok {
+				renames[name] = fmt.Sprintf("%s@%d", name, atomic.AddInt64(&gensym, 1))
+			}
+		}
+		return true
+	})
+
+	// 3. 改名，同时把占位换成unquote的结果
+	var err *object.Error
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if i, ok := placeholderIndex(node); ok {
+				ret, unquoteErr := unquote(unquotes[i], env)
+				if unquoteErr != nil && err == nil {
+					err = unquoteErr
+				}
+				return ret
+			}
+			if name, ok := renames[node.Value]; ok {
+				node.Value = name
+			}
+		case *ast.FunctionLiteral:
+			if name, ok := renames[node.Name]; ok {
+				node.Name = name
+			}
+		}
+		return node
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+func unquote(call *ast.CallExpression, env *object.Environment) (ast.Node, *object.Error) {
+	if len(call.Arguments) != 1 {
+		return call, newError("wrong number of arguments to unquote. got=%d, want=1", len(call.Arguments))
+	}
+	evaluated := Eval(call.Arguments[0], env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return call, errObj
+	}
+	return convertObjectToASTNode(evaluated)
+}
+
+// boundNames return the names a node bind
+func boundNames(node ast.Node) []string {
+	names := []string{}
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		names = append(names, node.Name.Value)
+	case *ast.ForStatement:
+		names = append(names, node.Variable.Value)
+	case *ast.FunctionLiteral:
+		for _, p := range node.Parameters {
+			names = append(names, p.Value)
+		}
+	case *ast.MacroLiteral:
+		for _, p := range node.Parameters {
+			names = append(names, p.Value)
+		}
+	case *ast.BindingPattern:
+		names = append(names, node.Name.Value)
+	case *ast.TryStatement:
+		if node.Param != nil {
+			names = append(names, node.Param.Value)
+		}
+	}
+	return names
+}
+
+// a placeholder can't be written by the user, the lexer reject '@'
+func placeholder(i int) *ast.Identifier {
+	name := fmt.Sprintf("@unquote%d", i)
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func placeholderIndex(ident *ast.Identifier) (int, bool) {
+	var i int
+	_, err := fmt.Sscanf(ident.Value, "@unquote%d", &i)
+	return i, err == nil
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+func convertObjectToASTNode(obj object.Object) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: strconv.FormatInt(obj.Value, 10)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: strconv.FormatFloat(obj.Value, 'g', -1, 64)}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, nil
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+	case *object.Quote:
+		return obj.Node, nil
+	default:
+		return nil, newError("cannot unquote %s", obj.Type())
+	}
+}
@@ -0,0 +1,135 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuote(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(1.5))`, `1.5`},
+		{`quote(unquote("s"))`, `s`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		testQuote(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteHygiene(t *testing.T) {
+	evaluated := testEval(`let x = quote(y); quote(fn(a) { let b = a; unquote(x) + b + c })`)
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+	str := quote.Node.String()
+	// the bound names are renamed, the unquoted and the free ones are not
+	for _, name := range []string{"fn(a@", "let b@", "y + b@", "+ c"} {
+		if !strings.Contains(str, name) {
+			t.Errorf("quote.Node.String() does not contain %q. got=%q", name, str)
+		}
+	}
+
+	// two quotes never generate the same name
+	first := testEval(`quote(fn(a) { a })`).(*object.Quote).Node.String()
+	second := testEval(`quote(fn(a) { a })`).(*object.Quote).Node.String()
+	if first == second {
+		t.Errorf("generated names are reused. got=%q twice", first)
+	}
+}
+
+func TestQuoteConcurrent(t *testing.T) {
+	const n = 8
+	names := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names <- testEval(`quote(fn(a) { a })`).(*object.Quote).Node.String()
+		}()
+	}
+	wg.Wait()
+	close(names)
+
+	seen := map[string]bool{}
+	for name := range names {
+		if seen[name] {
+			t.Errorf("generated names are reused. got=%q twice", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "wrong number of arguments to quote. got=2, want=1"},
+		{`quote(unquote())`, "wrong number of arguments to unquote. got=0, want=1"},
+		{`quote(unquote([1]))`, "cannot unquote ARRAY"},
+		{`quote(unquote(x))`, "identifier not found: x"},
+		{`unquote(1)`, "identifier not found: unquote"},
+		{`macro(x) { x }`, "macro must be bound by a top-level let"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: expected error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func testQuote(t *testing.T, evaluated object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil")
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
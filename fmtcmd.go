@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/format"
+	"os"
+)
+
+// runFmt is `monkey fmt [-w] [-d] [files]`, without file it format the
+// standard input to the standard output. It return the exit code.
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the file instead of the standard output")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey fmt [-w] [-d] [files]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "monkey fmt: cannot use -w with the standard input")
+			return 2
+		}
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey fmt: %s\n", err)
+			return 2
+		}
+		if err := fmtFile("<stdin>", src, false, *diff, stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		return 0
+	}
+
+	code := 0
+	for _, name := range flags.Args() {
+		src, err := ioutil.ReadFile(name)
+		if err == nil {
+			err = fmtFile(name, src, *write, *diff, stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = 2
+		}
+	}
+	return code
+}
+
+func fmtFile(name string, src []byte, write, diff bool, stdout io.Writer) error {
+	res, err := format.Source(name, src)
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		stdout.Write(format.Diff(name, src, res))
+	}
+	if write {
+		if bytes.Equal(src, res) {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(name, res, info.Mode().Perm())
+	}
+	if !diff {
+		stdout.Write(res)
+	}
+	return nil
+}
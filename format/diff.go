@@ -0,0 +1,167 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around a change
+const diffContext = 3
+
+// Diff return the unified diff from old to new, empty when they are equal.
+// The headers are name.orig and name, as gofmt -d.
+func Diff(name string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	a, b := splitLines(old), splitLines(new)
+	edits := lcsEdits(a, b)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	for _, h := range hunks(edits) {
+		writeHunk(&out, h, edits)
+	}
+	return out.Bytes()
+}
+
+func splitLines(src []byte) []string {
+	s := string(src)
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type editKind byte
+
+const (
+	editKeep   editKind = ' '
+	editDelete editKind = '-'
+	editInsert editKind = '+'
+)
+
+type edit struct {
+	kind editKind
+	text string
+	a, b int // line in old and in new, from 0, before this edit
+}
+
+// lcsEdits compute the edit script from a to b with a longest common
+// subsequence table, enough for source files
+func lcsEdits(a, b []string) []edit {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{editKeep, a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{editDelete, a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{editInsert, b[j], i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+// hunks group the changes with their context, a hunk is [start, end) in
+// the edits
+func hunks(edits []edit) [][2]int {
+	result := [][2]int{}
+	for i := 0; i < len(edits); i++ {
+		if edits[i].kind == editKeep {
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// 两处修改之间不超过 2*diffContext 行就合并
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != editKeep {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].kind == editKeep {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = next
+		}
+		if n := len(result); n > 0 && result[n-1][1] >= start {
+			result[n-1][1] = end
+		} else {
+			result = append(result, [2]int{start, end})
+		}
+		i = end - 1
+	}
+	return result
+}
+
+func writeHunk(out *bytes.Buffer, h [2]int, edits []edit) {
+	first := edits[h[0]]
+	var na, nb int
+	for _, e := range edits[h[0]:h[1]] {
+		if e.kind != editInsert {
+			na++
+		}
+		if e.kind != editDelete {
+			nb++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(first.a, na), hunkRange(first.b, nb))
+	for _, e := range edits[h[0]:h[1]] {
+		out.WriteByte(byte(e.kind))
+		out.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange format start,count with lines from 1, an empty range is
+// given by the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,705 @@
+// Package format print Monkey programs in the canonical style: 4 spaces of
+// indentation, one statement per line, long lists wrapped one item per
+// line, comments kept where they were.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// LineWidth is the width above which a list is wrapped
+	LineWidth = 80
+
+	indentText = "    "
+)
+
+// Source format src, the content of filename. An error is returned when
+// src does not parse.
+func Source(filename string, src []byte) ([]byte, error) {
+	p := parser.New(lexer.NewFile(filename, string(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+
+	pr := &printer{src: src, comments: collectComments(filename, src)}
+	pr.program(program)
+	return pr.out.Bytes(), nil
+}
+
+// Program return the canonical source of program. Without the source text
+// there is no comment, and the literals are printed from their value.
+func Program(program *ast.Program) string {
+	pr := &printer{}
+	pr.program(program)
+	return pr.out.String()
+}
+
+type comment struct {
+	token.Trivia
+	ownLine bool // nothing but blanks before it on its line
+}
+
+// collectComments lex src again keeping the trivia, the parser drop them
+func collectComments(filename string, src []byte) []comment {
+	l := lexer.NewFile(filename, string(src))
+	l.SetMode(lexer.ScanTrivia)
+
+	comments := []comment{}
+	for {
+		tok := l.NextToken()
+		for _, tr := range tok.Leading {
+			if tr.Kind == token.Whitespace {
+				continue
+			}
+			comments = append(comments, comment{Trivia: tr, ownLine: ownLine(src, tr.Pos.Offset)})
+		}
+		if tok.Type == token.EOF {
+			return comments
+		}
+	}
+}
+
+func ownLine(src []byte, offset int) bool {
+	for i := offset - 1; i >= 0; i-- {
+		switch src[i] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type printer struct {
+	src      []byte    // may be nil
+	comments []comment // not printed yet, in source order
+	out      bytes.Buffer
+
+	indent      int
+	col         int  // column of the next character, from 0
+	needIndent  bool // at the start of a line, the indentation is not written
+	needNewline bool // after a line comment
+	lastLine    int  // source line where the last printed thing end
+	afterBlock  bool // right after a /* */ comment, what follow on its line stay there
+	blockStart  bool // right after a '{', no blank line here
+	measuring   bool // rendering only to know the width, no comment
+	flat        bool // measuring the one line form, lists do not wrap
+}
+
+func (p *printer) write(s string) {
+	if p.needNewline {
+		p.newline()
+	}
+	if p.needIndent {
+		p.out.WriteString(strings.Repeat(indentText, p.indent))
+		p.col = len(indentText) * p.indent
+		p.needIndent = false
+	}
+	p.out.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+// newline end the line, the indentation is written with the next text so
+// blank lines have no trailing space
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.col = 0
+	p.needIndent = true
+	p.needNewline = false
+}
+
+func (p *printer) column() int {
+	if p.needIndent {
+		return len(indentText) * p.indent
+	}
+	return p.col
+}
+
+// linebreak start the line of something found at the given source line,
+// one blank line is kept if the source had some
+func (p *printer) linebreak(line int) {
+	if p.out.Len() == 0 {
+		return
+	}
+	if p.afterBlock && line == p.lastLine {
+		p.afterBlock = false
+		p.write(" ")
+		return
+	}
+	p.afterBlock = false
+	p.newline()
+	if !p.blockStart && p.lastLine > 0 && line > p.lastLine+1 {
+		p.newline()
+	}
+	p.blockStart = false
+}
+
+// flushComments print the comments found before offset. A comment alone
+// on its line stay alone, the others follow the current line.
+func (p *printer) flushComments(offset int) {
+	if p.measuring {
+		return
+	}
+	for len(p.comments) > 0 && p.comments[0].Pos.Offset < offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if c.ownLine || p.needNewline || p.out.Len() == 0 {
+			p.linebreak(c.Pos.Line)
+		} else {
+			p.write(" ")
+		}
+		p.write(c.Text)
+		p.lastLine = c.Pos.Line + strings.Count(c.Text, "\n")
+		if c.Kind == token.LineComment {
+			p.needNewline = true
+		} else {
+			p.afterBlock = true
+		}
+	}
+}
+
+func (p *printer) hasComments(from, to token.Position) bool {
+	for _, c := range p.comments {
+		if c.Pos.Offset >= to.Offset {
+			return false
+		}
+		if c.Pos.Offset >= from.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// measure return what f print, starting at the current column
+func (p *printer) measure(f func(q *printer)) string {
+	q := &printer{src: p.src, comments: p.comments, indent: p.indent, col: p.column(), measuring: true, flat: p.flat}
+	f(q)
+	return q.out.String()
+}
+
+// fits report whether text, printed from the current column, is a single
+// line not longer than LineWidth
+func (p *printer) fits(text string) bool {
+	return !strings.Contains(text, "\n") && p.column()+utf8.RuneCountInString(text) <= LineWidth
+}
+
+// singleLine report whether node was on one line in the source
+func singleLine(node ast.Node) bool {
+	return node.Pos().IsValid() && node.Pos().Line == node.End().Line
+}
+
+// text return the source of tok, or fallback without source
+func (p *printer) text(tok token.Token, fallback string) string {
+	if p.src != nil && tok.Pos.IsValid() && tok.Pos.Offset < tok.End.Offset && tok.End.Offset <= len(p.src) {
+		return string(p.src[tok.Pos.Offset:tok.End.Offset])
+	}
+	return fallback
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.stmtList(program.Statements, token.Position{Offset: math.MaxInt32})
+	if p.out.Len() > 0 {
+		p.out.WriteByte('\n')
+	}
+}
+
+// stmtList print one statement per line, end is where the list stop in
+// the source, the comments before it belong to the list
+func (p *printer) stmtList(stmts []ast.Statement, end token.Position) {
+	for i, s := range stmts {
+		p.flushComments(s.Pos().Offset)
+		p.linebreak(s.Pos().Line)
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+		p.stmt(s, next)
+		p.lastLine = s.End().Line
+	}
+	p.flushComments(end.Offset)
+}
+
+func (p *printer) stmt(s ast.Statement, next ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expr(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expr(s.ReturnValue, parser.LOWEST)
+		}
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expr(s.Expression, parser.LOWEST)
+		if !endsWithBlock(s.Expression) || p.continues(next) {
+			p.write(";")
+		}
+	case *ast.WhileStatement:
+		p.write("while (")
+		p.expr(s.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(s.Body, false)
+	case *ast.ForStatement:
+		p.write("for (" + s.Variable.Value + " in ")
+		p.expr(s.Iterable, parser.LOWEST)
+		p.write(") ")
+		p.block(s.Body, false)
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expr(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.TryStatement:
+		p.write("try ")
+		p.block(s.Block, false)
+		if s.Catch != nil {
+			p.write(" catch (" + s.Param.Value + ") ")
+			p.block(s.Catch, false)
+		}
+		if s.Finally != nil {
+			p.write(" finally ")
+			p.block(s.Finally, false)
+		}
+	case *ast.BreakStatement:
+		p.write("break;")
+	case *ast.ContinueStatement:
+		p.write("continue;")
+	case *ast.BlockStatement:
+		p.block(s, false)
+	}
+}
+
+// if and match statements need no ';'
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression, *ast.MatchExpression:
+		return true
+	}
+	return false
+}
+
+// continues report whether next would be parsed as the continuation of
+// the previous expression without a ';' in between, as in `if (a) {} -1`
+func (p *printer) continues(next ast.Statement) bool {
+	if next == nil {
+		return false
+	}
+	text := p.measure(func(q *printer) { q.stmt(next, nil) })
+	return strings.HasPrefix(text, "(") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "-")
+}
+
+// block print b, as `{ expr }` when inline
+func (p *printer) block(b *ast.BlockStatement, inline bool) {
+	if inline {
+		p.write("{ ")
+		p.expr(b.Statements[0].(*ast.ExpressionStatement).Expression, parser.LOWEST)
+		p.write(" }")
+		return
+	}
+	if len(b.Statements) == 0 && !p.hasComments(b.Pos(), b.End()) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.blockStart = true
+	p.stmtList(b.Statements, b.EndToken.Pos)
+	p.indent--
+	p.blockStart = false
+	p.newline()
+	p.write("}")
+	p.lastLine = b.End().Line
+}
+
+// inlineable report whether b can be `{ expr }`: it was on one line in the
+// source, has a single expression and no comment
+func (p *printer) inlineable(b *ast.BlockStatement) bool {
+	if len(b.Statements) != 1 || !singleLine(b) || p.hasComments(b.Pos(), b.End()) {
+		return false
+	}
+	_, ok := b.Statements[0].(*ast.ExpressionStatement)
+	return ok
+}
+
+// inline report whether the blocks printed by f stay inline, they must all
+// be inlineable and the result fit on the line
+func (p *printer) inline(f func(q *printer, inline bool), blocks ...*ast.BlockStatement) bool {
+	for _, b := range blocks {
+		if !p.inlineable(b) {
+			return false
+		}
+	}
+	return p.flat || p.fits(p.measure(func(q *printer) { f(q, true) }))
+}
+
+// precedence return the binding power of the operator at the top of exp,
+// above parser.INDEX for the expressions that never need parentheses
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(exp.Operator))
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.IntegerLiteral:
+		// a macro can build a negative literal, it print like -1
+		if exp.Value < 0 {
+			return parser.PREFIX
+		}
+	case *ast.FloatLiteral:
+		if exp.Value < 0 {
+			return parser.PREFIX
+		}
+	case *ast.CallExpression, *ast.IndexExpression:
+		return parser.CALL
+	}
+	return parser.INDEX + 1
+}
+
+// expr print exp, in parentheses when its operator bind less than prec
+func (p *printer) expr(exp ast.Expression, prec int) {
+	if precedence(exp) < prec {
+		p.write("(")
+		p.expr(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(p.text(exp.Token, strconv.FormatInt(exp.Value, 10)))
+	case *ast.FloatLiteral:
+		p.write(p.text(exp.Token, strconv.FormatFloat(exp.Value, 'g', -1, 64)))
+	case *ast.StringLiteral:
+		p.write(p.text(exp.Token, quote(exp.Value)))
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.expr(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(exp)
+		left, right := prec, prec+1
+		// ** is right associative
+		if exp.Operator == token.POWER {
+			left, right = prec+1, prec
+		}
+		p.expr(exp.Left, left)
+		p.write(" " + exp.Operator + " ")
+		p.expr(exp.Right, right)
+	case *ast.AssignExpression:
+		p.expr(exp.Target, parser.ASSIGN+1)
+		p.write(" = ")
+		p.expr(exp.Value, parser.ASSIGN)
+	case *ast.IfExpression:
+		p.ifExpr(exp)
+	case *ast.MatchExpression:
+		p.matchExpr(exp)
+	case *ast.FunctionLiteral:
+		p.function("fn", exp.Parameters, exp.Body)
+	case *ast.MacroLiteral:
+		p.function("macro", exp.Parameters, exp.Body)
+	case *ast.CallExpression:
+		p.expr(exp.Function, parser.CALL)
+		p.list("(", ")", exp.Token.Pos, exp.EndToken.Pos, len(exp.Arguments), func(i int) ast.Node {
+			return exp.Arguments[i]
+		}, func(q *printer, i int) {
+			q.expr(exp.Arguments[i], parser.LOWEST)
+		})
+	case *ast.IndexExpression:
+		p.expr(exp.Left, parser.CALL)
+		p.write("[")
+		p.expr(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.ArrayLiteral:
+		p.list("[", "]", exp.Token.Pos, exp.EndToken.Pos, len(exp.Elements), func(i int) ast.Node {
+			return exp.Elements[i]
+		}, func(q *printer, i int) {
+			q.expr(exp.Elements[i], parser.LOWEST)
+		})
+	case *ast.HashLiteral:
+		keys := p.sortedKeys(exp)
+		p.list("{", "}", exp.Token.Pos, exp.EndToken.Pos, len(keys), func(i int) ast.Node {
+			return keys[i]
+		}, func(q *printer, i int) {
+			q.expr(keys[i], parser.LOWEST)
+			q.write(": ")
+			q.expr(exp.Pairs[keys[i]], parser.LOWEST)
+		})
+	}
+}
+
+func identifiers(idents []*ast.Identifier) string {
+	names := []string{}
+	for _, ident := range idents {
+		names = append(names, ident.Value)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sortedKeys return the keys of the hash in source order, or by their
+// text when there is no position
+func (p *printer) sortedKeys(hash *ast.HashLiteral) []ast.Expression {
+	keys := make([]ast.Expression, 0, len(hash.Pairs))
+	texts := map[ast.Expression]string{}
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+		texts[key] = p.measure(func(q *printer) { q.expr(key, parser.LOWEST) })
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Pos().Offset != keys[j].Pos().Offset {
+			return keys[i].Pos().Offset < keys[j].Pos().Offset
+		}
+		return texts[keys[i]] < texts[keys[j]]
+	})
+	return keys
+}
+
+// list print open item, item close on one line, or one item per line
+// when that does not fit or there are comments between the items.
+// node(i) is the node of item i, for its position.
+func (p *printer) list(open, close string, start, end token.Position, n int,
+	node func(i int) ast.Node, item func(q *printer, i int)) {
+	if n == 0 {
+		p.write(open + close)
+		return
+	}
+
+	flat := p.measure(func(q *printer) {
+		q.flat = true
+		q.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				q.write(", ")
+			}
+			item(q, i)
+		}
+		q.write(close)
+	})
+	// 多行的元素（比如函数）直接跟在括号后面
+	firstLine := flat
+	if i := strings.IndexByte(flat, '\n'); i >= 0 {
+		firstLine = flat[:i]
+	}
+	if p.flat || !p.hasComments(start, end) && p.fits(firstLine) {
+		p.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			item(p, i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.write(open)
+	p.indent++
+	p.blockStart = true
+	for i := 0; i < n; i++ {
+		p.flushComments(node(i).Pos().Offset)
+		p.linebreak(node(i).Pos().Line)
+		item(p, i)
+		if i < n-1 {
+			p.write(",")
+		}
+		p.lastLine = node(i).End().Line
+	}
+	p.flushComments(end.Offset)
+	p.indent--
+	p.blockStart = false
+	p.newline()
+	p.write(close)
+}
+
+func (p *printer) function(keyword string, params []*ast.Identifier, body *ast.BlockStatement) {
+	p.write(keyword + "(" + identifiers(params) + ") ")
+	p.block(body, p.inline(func(q *printer, inline bool) { q.block(body, inline) }, body))
+}
+
+// ifExpr print the whole else if chain inline or not
+func (p *printer) ifExpr(exp *ast.IfExpression) {
+	blocks := []*ast.BlockStatement{}
+	for e := exp; ; {
+		blocks = append(blocks, e.Consequence)
+		if e.Alternative == nil {
+			break
+		}
+		elseIf := elseIfOf(e.Alternative)
+		if elseIf == nil {
+			blocks = append(blocks, e.Alternative)
+			break
+		}
+		e = elseIf
+	}
+	p.ifChain(exp, p.inline(func(q *printer, inline bool) { q.ifChain(exp, inline) }, blocks...))
+}
+
+func (p *printer) ifChain(exp *ast.IfExpression, inline bool) {
+	p.write("if (")
+	p.expr(exp.Condition, parser.LOWEST)
+	p.write(") ")
+	p.block(exp.Consequence, inline)
+	if exp.Alternative == nil {
+		return
+	}
+	p.write(" else ")
+	if elseIf := elseIfOf(exp.Alternative); elseIf != nil {
+		p.ifChain(elseIf, inline)
+		return
+	}
+	p.block(exp.Alternative, inline)
+}
+
+// elseIfOf return the if of an `else if`, the parser wrap it in a block
+// starting with the if token
+func elseIfOf(b *ast.BlockStatement) *ast.IfExpression {
+	if b.Token.Type != token.IF || len(b.Statements) != 1 {
+		return nil
+	}
+	es, ok := b.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	elseIf, _ := es.Expression.(*ast.IfExpression)
+	return elseIf
+}
+
+func (p *printer) matchExpr(exp *ast.MatchExpression) {
+	p.write("match (")
+	p.expr(exp.Value, parser.LOWEST)
+	p.write(") ")
+	if len(exp.Arms) == 0 {
+		p.write("{}")
+		return
+	}
+
+	if singleLine(exp) && !p.hasComments(exp.Pos(), exp.End()) {
+		flat := p.measure(func(q *printer) { q.inlineArms(exp.Arms) })
+		if p.fits(flat) {
+			p.inlineArms(exp.Arms)
+			return
+		}
+	}
+
+	p.write("{")
+	p.indent++
+	p.blockStart = true
+	for _, arm := range exp.Arms {
+		p.flushComments(arm.Pos().Offset)
+		p.linebreak(arm.Pos().Line)
+		p.matchArm(arm)
+		p.write(",")
+		p.lastLine = arm.End().Line
+	}
+	p.flushComments(exp.EndToken.Pos.Offset)
+	p.indent--
+	p.blockStart = false
+	p.newline()
+	p.write("}")
+}
+
+func (p *printer) inlineArms(arms []*ast.MatchArm) {
+	p.write("{ ")
+	for i, arm := range arms {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.matchArm(arm)
+	}
+	p.write(" }")
+}
+
+func (p *printer) matchArm(arm *ast.MatchArm) {
+	p.pattern(arm.Pattern)
+	if arm.Guard != nil {
+		p.write(" if ")
+		p.expr(arm.Guard, parser.LOWEST)
+	}
+	p.write(" => ")
+	p.expr(arm.Body, parser.LOWEST)
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		p.write("_")
+	case *ast.BindingPattern:
+		p.write(pattern.Name.Value)
+	case *ast.LiteralPattern:
+		p.expr(pattern.Value, parser.LOWEST)
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(el)
+		}
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		for i, key := range pattern.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(key, parser.LOWEST)
+			p.write(": ")
+			p.pattern(pattern.Values[i])
+		}
+		p.write("}")
+	}
+}
+
+// quote return the string literal of s, with the escapes of the lexer
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				out.WriteString(`\x` + strconv.FormatInt(int64(c)>>4, 16) + strconv.FormatInt(int64(c)&0xf, 16))
+				continue
+			}
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,264 @@
+package format
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"(1 + 2) * 3; 1 + (2 * 3); (1 - 2) - 3; 1 - (2 - 3);",
+			"(1 + 2) * 3;\n1 + 2 * 3;\n1 - 2 - 3;\n1 - (2 - 3);\n"},
+		{"(2 ** 3) ** 2; 2 ** (3 ** 2); -(1 + 2); (-a)[0]; (fn(x) { x })(1);",
+			"(2 ** 3) ** 2;\n2 ** 3 ** 2;\n-(1 + 2);\n(-a)[0];\nfn(x) { x }(1);\n"},
+		{"a = b = 1; (a = 1) + 2;", "a = b = 1;\n(a = 1) + 2;\n"},
+		{"let f = fn(a,b){a+b};", "let f = fn(a, b) { a + b };\n"},
+		{"let f = fn(a) {\nlet b = a;\nb\n};", "let f = fn(a) {\n    let b = a;\n    b;\n};\n"},
+		{"let f = fn() {};", "let f = fn() {};\n"},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "if (a) { 1 } else if (b) { 2 } else { 3 }\n"},
+		{"if (a) {\nb = 1;\n} else {\nb = 2;\n}",
+			"if (a) {\n    b = 1;\n} else {\n    b = 2;\n}\n"},
+		// ';' 不能省，否则下一行会接在 if 后面
+		{"if (a) { 1 }; -1;", "if (a) { 1 };\n-1;\n"},
+		{"if (a) { 1 }\nlet b = 1;", "if (a) { 1 }\nlet b = 1;\n"},
+		{"while (i < 3) { i = i + 1; }", "while (i < 3) {\n    i = i + 1;\n}\n"},
+		{"try { f() } catch (e) { throw e } finally { g() }",
+			"try {\n    f();\n} catch (e) {\n    throw e;\n} finally {\n    g();\n}\n"},
+		{"for (x in [1, 2]) { if (x == 1) { continue; } break; }",
+			"for (x in [1, 2]) {\n    if (x == 1) {\n        continue;\n    }\n    break;\n}\n"},
+		{`let h = {"a":1,"b":[1,2]};`, "let h = {\"a\": 1, \"b\": [1, 2]};\n"},
+		{`{"b": 1, "a": 2}`, "{\"b\": 1, \"a\": 2};\n"},
+		{"match (x) { 1 => \"one\", [a, _] if a > 0 => a, {\"k\": v} => v, _ => 0, }",
+			"match (x) { 1 => \"one\", [a, _] if a > 0 => a, {\"k\": v} => v, _ => 0 }\n"},
+		{"match (x) {\n1 => 2\n}", "match (x) {\n    1 => 2,\n}\n"},
+		{"let s = \"a\\tb\\\"\"; let f = 1.50;", "let s = \"a\\tb\\\"\";\nlet f = 1.50;\n"},
+		{"let m = macro(a) { quote(unquote(a) + 1) };", "let m = macro(a) { quote(unquote(a) + 1) };\n"},
+		// 只保留一个空行
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"let f = fn() {\n\nlet a = 1;\n\n\na\n\n};", "let f = fn() {\n    let a = 1;\n\n    a;\n};\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("test.mk", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// head\nlet x = 1; // x\n// tail\n", "// head\nlet x = 1; // x\n// tail\n"},
+		{"/* a */ let x = 1;", "/* a */ let x = 1;\n"},
+		{"let f = fn() {\n// inside\n1\n};", "let f = fn() {\n    // inside\n    1;\n};\n"},
+		{"let f = fn() {\n1\n// last\n};", "let f = fn() {\n    1;\n    // last\n};\n"},
+		{"let f = fn() { // only\n};", "let f = fn() { // only\n};\n"},
+		{"if (a) { 1 /* one */ }", "if (a) {\n    1; /* one */\n}\n"},
+		{"let a = [1, // one\n2];", "let a = [\n    1, // one\n    2\n];\n"},
+		{"let a = [\n// first\n1, 2];", "let a = [\n    // first\n    1,\n    2\n];\n"},
+		{"match (x) { 1 => 2, // one\n_ => 3 }", "match (x) {\n    1 => 2, // one\n    _ => 3,\n}\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("test.mk", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceWrapping(t *testing.T) {
+	long := strings.Repeat("x", 30)
+	short := strings.Repeat("z", 22)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let a = [" + long + ", " + long + ", " + long + "];",
+			"let a = [\n    " + long + ",\n    " + long + ",\n    " + long + "\n];\n",
+		},
+		{
+			"f(" + long + ", " + long + ", " + long + ");",
+			"f(\n    " + long + ",\n    " + long + ",\n    " + long + "\n);\n",
+		},
+		{
+			"let h = {\"" + long + "\": 1, \"" + long + "x\": 2, \"" + long + "y\": 3};",
+			"let h = {\n    \"" + long + "\": 1,\n    \"" + long + "x\": 2,\n    \"" + long + "y\": 3\n};\n",
+		},
+		// 里面的放得下，只有外层换行
+		{
+			"let a = [[" + short + ", " + short + ", " + short + "]];",
+			"let a = [\n    [" + short + ", " + short + ", " + short + "]\n];\n",
+		},
+		// 函数参数跟在括号后面
+		{
+			"map(arr, fn(x) {\nx * 2\n});",
+			"map(arr, fn(x) {\n    x * 2;\n});\n",
+		},
+		// 正好 80 列
+		{
+			"let a = [" + long + ", " + strings.Repeat("y", 36) + "];",
+			"let a = [" + long + ", " + strings.Repeat("y", 36) + "];\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source("test.mk", []byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("bad.mk", []byte("let x = ;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !strings.HasPrefix(err.Error(), "bad.mk:1:9:") {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+// 格式化的结果再格式化不变，语法树也不变
+func TestSourceIdempotent(t *testing.T) {
+	inputs := []string{
+		`
+// fibonacci
+let fibonacci = fn(x) {
+  if (x == 0) { 0 } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } }
+};
+
+
+let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}, {"name": "Bob", "age": 31}];
+let total = 0; /* sum */
+for (p in people) { total = total + p["age"]; }
+let describe = fn(v) { match (v) { 0 => "zero", [a, b] => a + b, {"name": n} if len(n) > 3 => n, _ => "?" } };
+while (total > 0) { total = total - 10; if (total < 50) { break; } }
+-(2 ** 3 ** 2) % 5 << 1 | 3 & ~1 ^ 2;
+!(true && false) || 1 >= 2 != 3 < 4;
+`,
+		"let s = \"tab\\there\";\nlet f = 0.5e3;\nputs(s, f)",
+	}
+
+	for _, input := range inputs {
+		first, err := Source("test.mk", []byte(input))
+		if err != nil {
+			t.Fatalf("Source error: %s", err)
+		}
+		second, err := Source("test.mk", first)
+		if err != nil {
+			t.Fatalf("Source error on its own output: %s\n%s", err, first)
+		}
+		if string(first) != string(second) {
+			t.Errorf("not idempotent.\nfirst:\n%s\nsecond:\n%s", first, second)
+		}
+		// Program print hash keys in a stable order, String does not
+		if Program(parse(t, input)) != Program(parse(t, string(first))) {
+			t.Errorf("formatting changed the program.\ninput:\n%s\noutput:\n%s", input, first)
+		}
+	}
+}
+
+func TestProgram(t *testing.T) {
+	// 没有源码的语法树，比如宏展开的结果
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.InfixExpression{
+			Left:     &ast.IntegerLiteral{Value: -1},
+			Operator: "**",
+			Right:    &ast.StringLiteral{Value: "a\n\"b\"\x01"},
+		}},
+		&ast.ExpressionStatement{Expression: &ast.HashLiteral{Pairs: map[ast.Expression]ast.Expression{
+			&ast.StringLiteral{Value: "b"}: &ast.FloatLiteral{Value: 1.5},
+			&ast.StringLiteral{Value: "a"}: &ast.Boolean{Value: true},
+		}}},
+	}}
+	expected := "(-1) ** \"a\\n\\\"b\\\"\\x01\";\n{\"a\": true, \"b\": 1.5};\n"
+	if got := Program(program); got != expected {
+		t.Errorf("Program wrong.\nwant=%q\ngot =%q", expected, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if got := Diff("a.mk", []byte("x\n"), []byte("x\n")); len(got) != 0 {
+		t.Errorf("diff of equal sources should be empty. got=%q", got)
+	}
+
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n16\n"
+	expected := `--- a.mk.orig
++++ a.mk
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++16
+`
+	if got := string(Diff("a.mk", []byte(old), []byte(new))); got != expected {
+		t.Errorf("Diff wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+
+	expected = "--- b.mk.orig\n+++ b.mk\n@@ -1 +1 @@\n-let x=1\n\\ No newline at end of file\n+let x = 1;\n"
+	if got := string(Diff("b.mk", []byte("let x=1"), []byte("let x = 1;\n"))); got != expected {
+		t.Errorf("Diff wrong.\nwant=%q\ngot =%q", expected, got)
+	}
+}
+
+func TestLiteralTokenSpan(t *testing.T) {
+	// 字面量直接从源码里截取，要包括引号
+	src := `let s = "a\"b";`
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.STRING {
+			if got := src[tok.Pos.Offset:tok.End.Offset]; got != `"a\"b"` {
+				t.Errorf("string token span wrong. got=%q", got)
+			}
+			return
+		}
+	}
+	t.Fatalf("no string token")
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
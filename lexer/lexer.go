@@ -1,19 +1,44 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mode controls what the lexer keeps besides tokens
+type Mode uint
+
+const (
+	// ScanTrivia keep comments and whitespace, attached to the next token
+	ScanTrivia Mode = 1 << iota
 )
 
 type Lexer struct {
+	mode         Mode
+	file         string
 	input        string
-	ch           byte
+	ch           rune // current character, 0 at the end of input
 	position     int
 	readPosition int
+
+	// line and column of l.ch
+	line   int
+	column int
 }
 
 func New(input string) *Lexer {
+	return NewFile("", input)
+}
+
+// NewFile create a lexer whose token positions carry the file name
+func NewFile(file, input string) *Lexer {
 	l := &Lexer{
+		file:  file,
 		input: input,
+		line:  1,
 	}
 	l.readChar()
 
@@ -21,26 +46,167 @@ func New(input string) *Lexer {
 }
 
 func (l *Lexer) readChar() {
+	// already past the end of input, stay there
+	if l.readPosition > len(l.input) {
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
+		l.readPosition++
 	} else {
-		l.ch = l.input[l.readPosition]
+		// an invalid encoding is read as utf8.RuneError of size 1
+		ch, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		l.ch = ch
+		l.readPosition += size
 	}
-	l.position = l.readPosition
-	l.readPosition++
+	// column count characters, not bytes
+	l.column++
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// SetMode change the lexer mode, call it before the first NextToken
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// currentPosition is the position of l.ch
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		File:   l.file,
+		Offset: l.position,
+		Line:   l.line,
+		Column: l.column,
+	}
+}
+
+// atEnd report whether l.ch is past the end of input, a NUL byte read
+// from the input is not
+func (l *Lexer) atEnd() bool {
+	return l.position >= len(l.input)
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.peekCharN(1)
+}
+
+// peekCharN look n characters ahead of l.ch without consuming anything
+func (l *Lexer) peekCharN(n int) rune {
+	offset := l.readPosition
+	for i := 1; i < n && offset < len(l.input); i++ {
+		_, size := utf8.DecodeRuneInString(l.input[offset:])
+		offset += size
+	}
+	if offset >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[offset:])
+	return ch
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	leading, ok := l.skipTrivia()
+	if ok {
+		pos := l.currentPosition()
+		tok = l.readToken()
+		tok.Pos = pos
+		tok.End = l.currentPosition()
+	} else {
+		// the last trivia is an unterminated block comment
+		last := leading[len(leading)-1]
+		tok = token.Token{
+			Type:    token.ILLEGAL,
+			Literal: "unterminated block comment",
+			Pos:     last.Pos,
+			End:     l.currentPosition(),
+		}
+		leading = leading[:len(leading)-1]
+	}
+
+	if l.mode&ScanTrivia != 0 {
+		tok.Leading = leading
+	}
+
+	return tok
+}
+
+// skipTrivia skip whitespace and comments in front of the next token,
+// return false when a block comment is never closed
+func (l *Lexer) skipTrivia() ([]token.Trivia, bool) {
+	var trivia []token.Trivia
+	for {
+		start := l.currentPosition()
+		var kind token.TriviaKind
+		ok := true
+
+		switch {
+		case isWhitespace(l.ch):
+			l.skipWhitespace()
+			kind = token.Whitespace
+		case l.ch == '/' && l.peekChar() == '/':
+			l.skipLineComment()
+			kind = token.LineComment
+		case l.ch == '/' && l.peekChar() == '*':
+			ok = l.skipBlockComment()
+			kind = token.BlockComment
+		default:
+			return trivia, true
+		}
+
+		// an unterminated comment is always reported, whatever the mode
+		if l.mode&ScanTrivia != 0 || !ok {
+			trivia = append(trivia, token.Trivia{
+				Kind: kind,
+				Text: l.input[start.Offset:l.position],
+				Pos:  start,
+			})
+		}
+		if !ok {
+			return trivia, false
+		}
+	}
+}
+
+// skipLineComment skip a '//' comment, the newline is left alone
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && !l.atEnd() {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skip a '/* */' comment, comments can be nested
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+	for {
+		switch {
+		case l.atEnd():
+			return false
+		case l.ch == '/' && l.peekChar() == '*':
+			// consume the /*
+			l.readChar()
+			l.readChar()
+			depth++
+		case l.ch == '*' && l.peekChar() == '/':
+			// consume the */
+			l.readChar()
+			l.readChar()
+			depth--
+			if depth == 0 {
+				return true
+			}
+		default:
+			l.readChar()
+		}
+	}
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case ',':
@@ -76,20 +242,89 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			tok.Type = token.EQ
 			tok.Literal = "=="
+		} else if nch == '>' {
+			// consume the >
+			l.readChar()
+			tok = newToken(token.ARROW, "=>")
 		} else {
 			tok = newToken(token.ASSIGN, "=")
 		}
 	case '/':
 		tok = newToken(token.SLASH, "/")
 	case '*':
-		tok = newToken(token.ASTERISK, "*")
+		if l.peekChar() == '*' {
+			// consume the second *
+			l.readChar()
+			tok = newToken(token.POWER, "**")
+		} else {
+			tok = newToken(token.ASTERISK, "*")
+		}
+	case '%':
+		tok = newToken(token.PERCENT, "%")
+	case '^':
+		tok = newToken(token.BIT_XOR, "^")
+	case '~':
+		tok = newToken(token.BIT_NOT, "~")
 	case '<':
-		tok = newToken(token.LT, "<")
+		switch l.peekChar() {
+		case '=':
+			// consume the =
+			l.readChar()
+			tok = newToken(token.LT_EQ, "<=")
+		case '<':
+			// consume the second <
+			l.readChar()
+			tok = newToken(token.SHL, "<<")
+		default:
+			tok = newToken(token.LT, "<")
+		}
 	case '>':
-		tok = newToken(token.GT, ">")
+		switch l.peekChar() {
+		case '=':
+			// consume the =
+			l.readChar()
+			tok = newToken(token.GT_EQ, ">=")
+		case '>':
+			// consume the second >
+			l.readChar()
+			tok = newToken(token.SHR, ">>")
+		default:
+			tok = newToken(token.GT, ">")
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			// consume the second &
+			l.readChar()
+			tok = newToken(token.AND, "&&")
+		} else {
+			tok = newToken(token.BIT_AND, "&")
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			// consume the second |
+			l.readChar()
+			tok = newToken(token.OR, "||")
+		} else {
+			tok = newToken(token.BIT_OR, "|")
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, errMsg := l.readString()
+		if errMsg != "" {
+			tok.Type = token.ILLEGAL
+			tok.Literal = errMsg
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = str
+		}
+	case '`':
+		str, ok := l.readRawString()
+		if !ok {
+			tok.Type = token.ILLEGAL
+			tok.Literal = "unterminated raw string literal"
+		} else {
+			tok.Type = token.STRING
+			tok.Literal = str
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, "[")
 	case ']':
@@ -97,8 +332,15 @@ func (l *Lexer) NextToken() token.Token {
 	case ':':
 		tok = newToken(token.COLON, ":")
 	case 0:
+		// a NUL byte read from the input is not the end
+		if !l.atEnd() {
+			tok = newToken(token.ILLEGAL, fmt.Sprintf("illegal character %q", l.ch))
+			break
+		}
 		tok.Literal = ""
 		tok.Type = token.EOF
+		// stay at the end of input, so EOF keep the same position
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readLetter()
@@ -106,11 +348,10 @@ func (l *Lexer) NextToken() token.Token {
 			// readLetter already contain readChar, so we return here
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readDigit()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
-			tok.Literal = string(l.ch)
+			tok.Literal = fmt.Sprintf("illegal character %q", l.ch)
 			tok.Type = token.ILLEGAL
 		}
 	}
@@ -120,8 +361,12 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+func isWhitespace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for isWhitespace(l.ch) {
 		l.readChar()
 	}
 }
@@ -133,9 +378,11 @@ func newToken(t token.TokenType, raw string) token.Token {
 	}
 }
 
-func isLetter(ch byte) bool {
+// isLetter accept unicode letters, so identifiers are not limited to ASCII
+func isLetter(ch rune) bool {
 	return (ch >= 'a' && ch <= 'z') ||
-		(ch >= 'A' && ch <= 'Z') || ch == '_'
+		(ch >= 'A' && ch <= 'Z') || ch == '_' ||
+		(ch >= utf8.RuneSelf && unicode.IsLetter(ch))
 }
 
 func (l *Lexer) readLetter() string {
@@ -147,26 +394,177 @@ func (l *Lexer) readLetter() string {
 	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+// readDigit read decimal digits, '_' is allowed as a separator
 func (l *Lexer) readDigit() string {
 	position := l.position
-	for isDigit(l.ch) {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
+// readNumber read an integer or a float like 1.5, 1e10 or 2.5E-3,
+// integers can also be written as 0xff, 0o17 or 0b1010
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	if l.ch == '0' && isBasePrefix(l.peekChar()) {
+		// pass 0 and the base letter, the digits are validated by the parser
+		l.readChar()
+		l.readChar()
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		return l.input[position:l.position], tokenType
+	}
+
+	l.readDigit()
+	// a fraction must have digits after the dot
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		// pass .
+		l.readChar()
+		l.readDigit()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || ((next == '+' || next == '-') && isDigit(l.peekCharN(2))) {
+			tokenType = token.FLOAT
+			// pass e and the sign
+			l.readChar()
+			if !isDigit(l.ch) {
+				l.readChar()
+			}
+			l.readDigit()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+// readString read a double quoted string and decode its escape sequences,
+// it can span lines. On return l.ch is the closing quote. The second result is the error
+// message when the string is malformed.
+func (l *Lexer) readString() (string, string) {
+	var out strings.Builder
+	errMsg := ""
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), errMsg
+		case '\\':
+			l.readChar()
+			// keep going to the closing quote, only the first error is reported
+			if msg := l.readEscape(&out); msg != "" && errMsg == "" {
+				errMsg = msg
+			}
+		default:
+			// a NUL byte is a character, only the end of input ends it
+			if l.atEnd() {
+				return "", "unterminated string literal"
+			}
+			// copy the raw bytes, an invalid encoding is kept as is
+			out.WriteString(l.input[l.position:l.readPosition])
+		}
+	}
+}
+
+// readEscape decode the escape sequence after a backslash, l.ch is the
+// first character after the backslash and the last one of the sequence on
+// return
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\':
+		out.WriteByte('\\')
+	case '"':
+		out.WriteByte('"')
+	case 'x':
+		value := 0
+		for i := 0; i < 2; i++ {
+			if !isHexDigit(l.peekChar()) {
+				return `invalid escape sequence: \x must be followed by 2 hex digits`
+			}
+			l.readChar()
+			value = value*16 + hexValue(l.ch)
+		}
+		// \xff is the character U+00FF, a lone byte is not valid UTF-8
+		out.WriteRune(rune(value))
+	case 'u':
+		if l.peekChar() != '{' {
+			return `invalid escape sequence: \u must be followed by {`
+		}
+		l.readChar()
+		value, digits := 0, 0
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			value = value*16 + hexValue(l.ch)
+			digits++
+			if digits > 6 {
+				return `invalid escape sequence: \u{...} takes at most 6 hex digits`
+			}
+		}
+		if digits == 0 || l.peekChar() != '}' {
+			return `invalid escape sequence: \u{...} must be hex digits closed by }`
+		}
+		l.readChar()
+		if !utf8.ValidRune(rune(value)) {
+			return fmt.Sprintf(`invalid escape sequence: \u{%x} is not a valid code point`, value)
+		}
+		out.WriteRune(rune(value))
+	default:
+		return fmt.Sprintf(`unknown escape sequence: \%c`, l.ch)
+	}
+	return ""
+}
+
+// readRawString read a backtick string, nothing is escaped in it and it
+// can span lines
+func (l *Lexer) readRawString() (string, bool) {
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' {
-			break
+		switch l.ch {
+		case '`':
+			return l.input[position:l.position], true
+		}
+		if l.atEnd() {
+			return "", false
 		}
 	}
-	return l.input[position:l.position]
+}
+
+func isBasePrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func hexValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	default:
+		return int(ch-'A') + 10
+	}
 }
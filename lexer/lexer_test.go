@@ -18,7 +18,7 @@ let add = fn(x, y) {
 
 let result = add(five, ten);
 
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -161,3 +161,397 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 10;
+  x + "ab";`
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedPos    token.Position
+		expectedEndCol int
+	}{
+		{token.LET, token.Position{File: "a.mk", Offset: 0, Line: 1, Column: 1}, 4},
+		{token.IDENT, token.Position{File: "a.mk", Offset: 4, Line: 1, Column: 5}, 6},
+		{token.ASSIGN, token.Position{File: "a.mk", Offset: 6, Line: 1, Column: 7}, 8},
+		{token.INT, token.Position{File: "a.mk", Offset: 8, Line: 1, Column: 9}, 11},
+		{token.SEMICOLON, token.Position{File: "a.mk", Offset: 10, Line: 1, Column: 11}, 12},
+		{token.IDENT, token.Position{File: "a.mk", Offset: 14, Line: 2, Column: 3}, 4},
+		{token.PLUS, token.Position{File: "a.mk", Offset: 16, Line: 2, Column: 5}, 6},
+		{token.STRING, token.Position{File: "a.mk", Offset: 18, Line: 2, Column: 7}, 11},
+		{token.SEMICOLON, token.Position{File: "a.mk", Offset: 22, Line: 2, Column: 11}, 12},
+		{token.EOF, token.Position{File: "a.mk", Offset: 23, Line: 2, Column: 12}, 12},
+	}
+
+	l := NewFile("a.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End.Line != tt.expectedPos.Line || tok.End.Column != tt.expectedEndCol {
+			t.Fatalf("tests[%d] - end wrong. expected=%d:%d, got=%s", i, tt.expectedPos.Line, tt.expectedEndCol, tok.End)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2;
+/* never closed`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "unterminated block comment"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if len(tok.Leading) != 0 {
+			t.Fatalf("tests[%d] - trivia kept without ScanTrivia: %+v", i, tok.Leading)
+		}
+	}
+}
+
+func TestScanTrivia(t *testing.T) {
+	input := "// doc\nlet /* a */ x"
+
+	l := New(input)
+	l.SetMode(ScanTrivia)
+
+	tok := l.NextToken()
+	expected := []token.Trivia{
+		{Kind: token.LineComment, Text: "// doc", Pos: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Kind: token.Whitespace, Text: "\n", Pos: token.Position{Offset: 6, Line: 1, Column: 7}},
+	}
+	testTrivia(t, tok, token.LET, expected)
+
+	tok = l.NextToken()
+	expected = []token.Trivia{
+		{Kind: token.Whitespace, Text: " ", Pos: token.Position{Offset: 10, Line: 2, Column: 4}},
+		{Kind: token.BlockComment, Text: "/* a */", Pos: token.Position{Offset: 11, Line: 2, Column: 5}},
+		{Kind: token.Whitespace, Text: " ", Pos: token.Position{Offset: 18, Line: 2, Column: 12}},
+	}
+	testTrivia(t, tok, token.IDENT, expected)
+}
+
+func testTrivia(t *testing.T, tok token.Token, tokenType token.TokenType, expected []token.Trivia) {
+	t.Helper()
+
+	if tok.Type != tokenType {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", tokenType, tok.Type)
+	}
+	if len(tok.Leading) != len(expected) {
+		t.Fatalf("wrong number of trivia. expected=%d, got=%d (%+v)", len(expected), len(tok.Leading), tok.Leading)
+	}
+	for i, tr := range expected {
+		if tok.Leading[i] != tr {
+			t.Errorf("trivia[%d] wrong. expected=%+v, got=%+v", i, tr, tok.Leading[i])
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc"},
+		{`"quote \" and backslash \\"`, token.STRING, `quote " and backslash \`},
+		{`"\x41\x62"`, token.STRING, "Ab"},
+		{`"\u{3bb}\u{1F600}"`, token.STRING, "λ😀"},
+		{"`raw \\n\nline`", token.STRING, "raw \\n\nline"},
+		{`"abc`, token.ILLEGAL, "unterminated string literal"},
+		{"\"abc\ndef\"", token.STRING, "abc\ndef"},
+		{"\"a\x00b\"", token.STRING, "a\x00b"},
+		{"`a\x00b`", token.STRING, "a\x00b"},
+		{`"\xe9\x7f"`, token.STRING, "é\x7f"},
+		{"`abc", token.ILLEGAL, "unterminated raw string literal"},
+		{`"\q"`, token.ILLEGAL, `unknown escape sequence: \q`},
+		{`"\x4"`, token.ILLEGAL, `invalid escape sequence: \x must be followed by 2 hex digits`},
+		{`"\u{}"`, token.ILLEGAL, `invalid escape sequence: \u{...} must be hex digits closed by }`},
+		{`"\u{d800}"`, token.ILLEGAL, `invalid escape sequence: \u{d800} is not a valid code point`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringErrorResync(t *testing.T) {
+	// a bad escape does not swallow the tokens after the string
+	l := New(`"\q" + 1`)
+	expected := []token.TokenType{token.ILLEGAL, token.PLUS, token.INT, token.EOF, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestNulByte(t *testing.T) {
+	// a NUL byte is not the end of input, in a comment or outside of one
+	l := New("1 // a\x00b\n2 /* \x00 */ 3 \x00 4")
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1"},
+		{token.INT, "2"},
+		{token.INT, "3"},
+		{token.ILLEGAL, `illegal character '\x00'`},
+		{token.INT, "4"},
+		{token.EOF, ""},
+	}
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i,
+				tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 1.5 0.25 1e10 2.5E-3 7e+2 3.x 4e`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "7e+2"},
+		// no digit after the dot or the exponent, not a float
+		{token.INT, "3"},
+		{token.ILLEGAL, "illegal character '.'"},
+		{token.IDENT, "x"},
+		{token.INT, "4"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := `a <= b >= c && d || e < =`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.LT, "<"},
+		{token.ASSIGN, "="},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestArithmeticOperators(t *testing.T) {
+	input := `a % b ** c & d | e ^ ~f << g >> h * i`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "d"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "e"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENT, "f"},
+		{token.SHL, "<<"},
+		{token.IDENT, "g"},
+		{token.SHR, ">>"},
+		{token.IDENT, "h"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "i"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match (x) { 1 => a, _ => b }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "b"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIntegerBases(t *testing.T) {
+	input := `0xFF_ff 0o17 0b1010_1010 1_000_000 1_000.5 0b102`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF_ff"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1010_1010"},
+		{token.INT, "1_000_000"},
+		{token.FLOAT, "1_000.5"},
+		// the parser reject the bad digit
+		{token.INT, "0b102"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let λ = "日本"; café + π`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "λ", 5},
+		{token.ASSIGN, "=", 7},
+		{token.STRING, "日本", 9},
+		{token.SEMICOLON, ";", 13},
+		{token.IDENT, "café", 15},
+		{token.PLUS, "+", 20},
+		{token.IDENT, "π", 22},
+		{token.EOF, "", 23},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+
+	l = New("1 ∑ 2")
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "illegal character '∑'" {
+		t.Fatalf("expected illegal '∑', got=%q %q", tok.Type, tok.Literal)
+	}
+}
@@ -0,0 +1,232 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// MaxShift is the largest shift count or exponent accepted for big
+// integers, it keeps 1 << n from allocating an absurd amount of memory
+const MaxShift = 1 << 20
+
+// BigInt is an integer that does not fit in int64. Arithmetic on
+// Integer promote to BigInt on overflow, and a BigInt is demoted back
+// as soon as it fits again, so an integer value always has exactly one
+// representation.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+func (b *BigInt) Type() ObjectType {
+	return BIGINT_OBJ
+}
+
+func (b *BigInt) HashKey() HashKey {
+	// should not happen since NewBigInt demote, but keep equal values equal
+	if b.Value.IsInt64() {
+		return (&Integer{Value: b.Value.Int64()}).HashKey()
+	}
+	h := fnv.New64a()
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(b.Value.Bytes())
+
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// NewBigInt wrap v, an Integer is returned when v fits in int64
+func NewBigInt(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// IsInteger report whether obj is an Integer or a BigInt
+func IsInteger(obj Object) bool {
+	t := obj.Type()
+	return t == INTEGER_OBJ || t == BIGINT_OBJ
+}
+
+// ToBigInt convert an Integer or a BigInt to a big.Int, the result must
+// not be modified
+func ToBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return obj.Value
+	default:
+		return nil
+	}
+}
+
+// BigIntToFloat convert a big integer to the nearest float64
+func BigIntToFloat(v *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// AddInt64 return a + b, ok is false when it overflows
+func AddInt64(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+// SubInt64 return a - b, ok is false when it overflows
+func SubInt64(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+// MulInt64 return a * b, ok is false when it overflows
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	c := a * b
+	return c, c/b == a
+}
+
+// DivInt64 return a / b, ok is false when it overflows or b is 0
+func DivInt64(a, b int64) (int64, bool) {
+	if b == 0 || (a == math.MinInt64 && b == -1) {
+		return 0, false
+	}
+	return a / b, true
+}
+
+// ModInt64 return a % b, the sign follow a, ok is false when b is 0
+func ModInt64(a, b int64) (int64, bool) {
+	if b == 0 {
+		return 0, false
+	}
+	return a % b, true
+}
+
+// PowInt64 return a ** b, ok is false when it overflows or b is negative
+func PowInt64(a, b int64) (int64, bool) {
+	if b < 0 {
+		return 0, false
+	}
+	ret := int64(1)
+	ok := true
+	for b > 0 {
+		if b&1 == 1 {
+			if ret, ok = MulInt64(ret, a); !ok {
+				return 0, false
+			}
+		}
+		b >>= 1
+		if b > 0 {
+			if a, ok = MulInt64(a, a); !ok {
+				return 0, false
+			}
+		}
+	}
+	return ret, true
+}
+
+// ShlInt64 return a << n, ok is false when it overflows or n is negative
+func ShlInt64(a, n int64) (int64, bool) {
+	if n < 0 {
+		return 0, false
+	}
+	if a == 0 {
+		return 0, true
+	}
+	if n >= 63 {
+		return 0, false
+	}
+	c := a << uint(n)
+	return c, c>>uint(n) == a
+}
+
+// ShrInt64 return a >> n, the shift is arithmetic, ok is false when n is
+// negative
+func ShrInt64(a, n int64) (int64, bool) {
+	if n < 0 {
+		return 0, false
+	}
+	if n > 63 {
+		n = 63
+	}
+	return a >> uint(n), true
+}
+
+// The Int64 helpers above give up on the edge cases, the functions below
+// are the general version and report the errors.
+
+// DivBigInt return a / b truncated toward zero
+func DivBigInt(a, b *big.Int) (Object, error) {
+	if b.Sign() == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return NewBigInt(new(big.Int).Quo(a, b)), nil
+}
+
+// ModBigInt return a % b, the sign follow a like Go
+func ModBigInt(a, b *big.Int) (Object, error) {
+	if b.Sign() == 0 {
+		return nil, fmt.Errorf("modulo by zero")
+	}
+	return NewBigInt(new(big.Int).Rem(a, b)), nil
+}
+
+// PowBigInt return a ** b, a negative exponent give a Float
+func PowBigInt(a, b *big.Int) (Object, error) {
+	if b.Sign() < 0 {
+		return &Float{Value: math.Pow(BigIntToFloat(a), BigIntToFloat(b))}, nil
+	}
+	// 0, 1 and -1 stay small whatever the exponent
+	if a.CmpAbs(big.NewInt(1)) <= 0 {
+		if a.Sign() < 0 && b.Bit(0) == 0 {
+			return &Integer{Value: 1}, nil
+		}
+		if b.Sign() == 0 {
+			return &Integer{Value: 1}, nil
+		}
+		return NewBigInt(a), nil
+	}
+	if !b.IsInt64() || b.Int64() > MaxShift {
+		return nil, fmt.Errorf("exponent too large: %s", b)
+	}
+	return NewBigInt(new(big.Int).Exp(a, b, nil)), nil
+}
+
+// ShlBigInt return a << n
+func ShlBigInt(a, n *big.Int) (Object, error) {
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("negative shift count: %s", n)
+	}
+	if a.Sign() == 0 {
+		return &Integer{Value: 0}, nil
+	}
+	if !n.IsInt64() || n.Int64() > MaxShift {
+		return nil, fmt.Errorf("shift count too large: %s", n)
+	}
+	return NewBigInt(new(big.Int).Lsh(a, uint(n.Int64()))), nil
+}
+
+// ShrBigInt return a >> n, the shift is arithmetic
+func ShrBigInt(a, n *big.Int) (Object, error) {
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("negative shift count: %s", n)
+	}
+	// shifting by the bit length or more already give 0 or -1
+	count := uint(a.BitLen())
+	if n.IsInt64() && n.Int64() < int64(count) {
+		count = uint(n.Int64())
+	}
+	return NewBigInt(new(big.Int).Rsh(a, count)), nil
+}
@@ -2,6 +2,7 @@ package object
 
 import (
 	"fmt"
+	"unicode/utf8"
 )
 
 var Builtins = []struct {
@@ -19,7 +20,8 @@ var Builtins = []struct {
 				case *Array:
 					return &Integer{Value: int64(len(arg.Elements))}
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
+					// count characters, not bytes
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 				default:
 					return newError("argument to `len` not supported, got=%s", args[0].Type())
 				}
@@ -126,6 +128,7 @@ var Builtins = []struct {
 func newError(format string, a ...interface{}) *Error {
 	return &Error{
 		Message: fmt.Sprintf(format, a...),
+		Kind:    BUILTIN_ERROR,
 	}
 }
 
@@ -137,3 +140,17 @@ func GetBuiltinByName(name string) *Builtin {
 	}
 	return nil
 }
+
+// BuiltinName return the name of b: its Name, or else the name it has in
+// Builtins, where the host may append builtins without a Name
+func BuiltinName(b *Builtin) string {
+	if b.Name != "" {
+		return b.Name
+	}
+	for _, def := range Builtins {
+		if def.Builtin == b {
+			return def.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package object
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Iterator walk an iterable value for the for-in loop. It is internal to
+// the engines and never reach the user.
+type Iterator struct {
+	next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType {
+	return ITERATOR_OBJ
+}
+
+func (it *Iterator) Inspect() string {
+	return "<iterator>"
+}
+
+// Next return the next element, ok is false once the iterator is exhausted
+func (it *Iterator) Next() (Object, bool) {
+	return it.next()
+}
+
+// NewIterator return an iterator over the elements of an array, the
+// characters of a string or the keys of a hash. ok is false when obj is
+// not iterable.
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		i := 0
+		return &Iterator{next: func() (Object, bool) {
+			// the array may change while looping, check the length each time
+			if i >= len(obj.Elements) {
+				return nil, false
+			}
+			i++
+			return obj.Elements[i-1], true
+		}}, true
+	case *String:
+		s := obj.Value
+		return &Iterator{next: func() (Object, bool) {
+			if len(s) == 0 {
+				return nil, false
+			}
+			r, size := utf8.DecodeRuneInString(s)
+			s = s[size:]
+			return &String{Value: string(r)}, true
+		}}, true
+	case *Hash:
+		keys := obj.SortedKeys()
+		i := 0
+		return &Iterator{next: func() (Object, bool) {
+			if i >= len(keys) {
+				return nil, false
+			}
+			i++
+			return keys[i-1], true
+		}}, true
+	default:
+		return nil, false
+	}
+}
+
+// SortedKeys return the keys of the hash in a stable order: numbers by
+// value first, then booleans, then strings
+func (h *Hash) SortedKeys() []Object {
+	keys := make([]Object, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+	return keys
+}
+
+func keyRank(obj Object) int {
+	switch obj.Type() {
+	case INTEGER_OBJ, BIGINT_OBJ, FLOAT_OBJ:
+		return 0
+	case BOOLEAN_OBJ:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func lessKey(a, b Object) bool {
+	ra, rb := keyRank(a), keyRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	if IsInteger(a) && IsInteger(b) {
+		return ToBigInt(a).Cmp(ToBigInt(b)) < 0
+	}
+	return numberValue(a) < numberValue(b)
+}
+
+func numberValue(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		return BigIntToFloat(obj.Value)
+	case *Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,216 @@
+package object
+
+import (
+	"fmt"
+	"monkey/ast"
+	"strings"
+)
+
+// MatchPattern is the runtime form of a match arm pattern. The compiler
+// store it in the constant pool, the evaluator build it on the fly.
+type MatchPattern struct {
+	root *patternNode
+	// Bindings are the names bound by the pattern, in the order of the
+	// values returned by Match
+	Bindings []string
+}
+
+type patternKind int
+
+const (
+	wildcardPattern patternKind = iota
+	bindingPattern
+	literalPattern
+	arrayPattern
+	hashPattern
+)
+
+type patternNode struct {
+	kind     patternKind
+	literal  Object         // literalPattern
+	keys     []Object       // hashPattern
+	children []*patternNode // arrayPattern elements or hashPattern values
+	binding  int            // bindingPattern, index in Bindings
+}
+
+func (mp *MatchPattern) Type() ObjectType {
+	return MATCH_PATTERN_OBJ
+}
+
+func (mp *MatchPattern) Inspect() string {
+	return mp.root.String(mp.Bindings)
+}
+
+func (n *patternNode) String(bindings []string) string {
+	switch n.kind {
+	case bindingPattern:
+		return bindings[n.binding]
+	case literalPattern:
+		return n.literal.Inspect()
+	case arrayPattern:
+		elements := []string{}
+		for _, child := range n.children {
+			elements = append(elements, child.String(bindings))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case hashPattern:
+		pairs := []string{}
+		for i, child := range n.children {
+			pairs = append(pairs, n.keys[i].Inspect()+": "+child.String(bindings))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return "_"
+	}
+}
+
+// NewMatchPattern convert a parsed pattern, it fails on a name bound twice
+func NewMatchPattern(p ast.Pattern) (*MatchPattern, error) {
+	mp := &MatchPattern{}
+	root, err := mp.convert(p)
+	if err != nil {
+		return nil, err
+	}
+	mp.root = root
+	return mp, nil
+}
+
+func (mp *MatchPattern) convert(p ast.Pattern) (*patternNode, error) {
+	switch p := p.(type) {
+	case *ast.WildcardPattern:
+		return &patternNode{kind: wildcardPattern}, nil
+	case *ast.BindingPattern:
+		for _, name := range mp.Bindings {
+			if name == p.Name.Value {
+				return nil, fmt.Errorf("%s bound more than once in pattern", name)
+			}
+		}
+		mp.Bindings = append(mp.Bindings, p.Name.Value)
+		return &patternNode{kind: bindingPattern, binding: len(mp.Bindings) - 1}, nil
+	case *ast.LiteralPattern:
+		literal, err := literalValue(p.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &patternNode{kind: literalPattern, literal: literal}, nil
+	case *ast.ArrayPattern:
+		node := &patternNode{kind: arrayPattern}
+		for _, el := range p.Elements {
+			child, err := mp.convert(el)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		}
+		return node, nil
+	case *ast.HashPattern:
+		node := &patternNode{kind: hashPattern}
+		for i, key := range p.Keys {
+			keyValue, err := literalValue(key)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := keyValue.(Hashable); !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", keyValue.Type())
+			}
+			child, err := mp.convert(p.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, keyValue)
+			node.children = append(node.children, child)
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("unknown pattern %T", p)
+	}
+}
+
+func literalValue(exp ast.Expression) (Object, error) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return &Integer{Value: exp.Value}, nil
+	case *ast.FloatLiteral:
+		return &Float{Value: exp.Value}, nil
+	case *ast.StringLiteral:
+		return &String{Value: exp.Value}, nil
+	case *ast.Boolean:
+		return &Boolean{Value: exp.Value}, nil
+	case *ast.PrefixExpression:
+		if exp.Operator == "-" {
+			switch right := exp.Right.(type) {
+			case *ast.IntegerLiteral:
+				return &Integer{Value: -right.Value}, nil
+			case *ast.FloatLiteral:
+				return &Float{Value: -right.Value}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid literal pattern %s", exp.String())
+}
+
+// Match test value against the pattern, on success the values of the
+// bindings are returned in the order of Bindings
+func (mp *MatchPattern) Match(value Object) ([]Object, bool) {
+	values := make([]Object, len(mp.Bindings))
+	if !mp.root.match(value, values) {
+		return nil, false
+	}
+	return values, true
+}
+
+func (n *patternNode) match(value Object, values []Object) bool {
+	switch n.kind {
+	case wildcardPattern:
+		return true
+	case bindingPattern:
+		values[n.binding] = value
+		return true
+	case literalPattern:
+		return literalEqual(n.literal, value)
+	case arrayPattern:
+		arr, ok := value.(*Array)
+		if !ok || len(arr.Elements) != len(n.children) {
+			return false
+		}
+		for i, child := range n.children {
+			if !child.match(arr.Elements[i], values) {
+				return false
+			}
+		}
+		return true
+	case hashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return false
+		}
+		for i, child := range n.children {
+			pair, ok := hash.Pairs[n.keys[i].(Hashable).HashKey()]
+			if !ok || !child.match(pair.Value, values) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// literalEqual compare like ==, numbers by value whatever their type
+func literalEqual(literal, value Object) bool {
+	switch literal := literal.(type) {
+	case *String:
+		str, ok := value.(*String)
+		return ok && str.Value == literal.Value
+	case *Boolean:
+		b, ok := value.(*Boolean)
+		return ok && b.Value == literal.Value
+	}
+	if IsInteger(literal) && IsInteger(value) {
+		return ToBigInt(literal).Cmp(ToBigInt(value)) == 0
+	}
+	if value.Type() == FLOAT_OBJ || IsInteger(value) {
+		return numberValue(literal) == numberValue(value)
+	}
+	return false
+}
@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/token"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	BIGINT_OBJ            = "BIGINT"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NIL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -22,6 +31,11 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	ITERATOR_OBJ          = "ITERATOR"
+	UPVALUE_OBJ           = "UPVALUE"
+	MATCH_PATTERN_OBJ     = "MATCH_PATTERN"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
 )
 
 type ObjectType string
@@ -43,6 +57,23 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep it looking like a float, 2.0 instead of 2
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -78,8 +109,59 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break and Continue are the signals of break and continue in the
+// evaluator, they travel up to the enclosing loop like ReturnValue
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// the kinds of errors, the type of an error seen by a catch
+const (
+	RUNTIME_ERROR = "RuntimeError" // raised by the engines
+	BUILTIN_ERROR = "BuiltinError" // returned by a builtin
+)
+
 type Error struct {
 	Message string
+	Kind    string
+	// Value is the value of a throw, the error only carry it to the catch
+	Value Object
+	// Caught is set once a catch got the error, it is a plain value then
+	// and not raised any more
+	Caught bool
+}
+
+// Catch returns e caught by the script, a plain value. e itself is left
+// as it is, a builtin may return the same error every time.
+func (e *Error) Catch() *Error {
+	return &Error{Message: e.Message, Kind: e.Kind, Caught: true}
+}
+
+// Field returns e["message"] and e["type"]
+func (e *Error) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}, true
+	case "type":
+		return &String{Value: e.Kind}, true
+	}
+	return nil, false
 }
 
 func (e *Error) Type() ObjectType {
@@ -119,10 +201,24 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Assign change an existing binding, in this environment or an outer one,
+// ok is false when name is not defined
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // the name it is bound to, empty when anonymous
 }
 
 func (f *Function) Type() ObjectType {
@@ -130,17 +226,58 @@ func (f *Function) Type() ObjectType {
 }
 
 func (f *Function) Inspect() string {
-	var out bytes.Buffer
 	params := []string{}
 	for _, p := range f.Parameters {
 		params = append(params, p.String())
 	}
+	return inspectFunction(f.Name, params)
+}
+
+// inspectFunction print a function as <fn name(a, b)>, or <fn(a, b)> when
+// it has no name
+func inspectFunction(name string, params []string) string {
+	if name != "" {
+		name = " " + name
+	}
+	return "<fn" + name + "(" + strings.Join(params, ", ") + ")>"
+}
+
+// Quote is the result of quote(), an unevaluated piece of code
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is a macro definition, only seen during the macro expansion
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
 
-	out.WriteString("fn")
+	out.WriteString("macro")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(m.Body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -158,10 +295,50 @@ func (s *String) Inspect() string {
 	return s.Value
 }
 
+// CharAt return the i-th character (not byte) of the string
+func (s *String) CharAt(i int64) (*String, bool) {
+	if i < 0 {
+		return nil, false
+	}
+	for _, ch := range s.Value {
+		if i == 0 {
+			return &String{Value: string(ch)}, true
+		}
+		i--
+	}
+	return nil, false
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// Name may be left empty for a builtin in Builtins, see BuiltinName
+	Name string
+	// ErrorValues is set by the builtins whose errors are values for the
+	// script to look at, the errors of the other builtins are raised
+	ErrorValues bool
+}
+
+// Call run the builtin, the error it return is raised unless the builtin
+// has ErrorValues. A nil result is null. A panic of the builtin is an
+// error too.
+func (b *Builtin) Call(args ...Object) (ret Object, raised *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ret, raised = nil, &Error{Message: fmt.Sprintf("builtin %s panicked: %v", BuiltinName(b), r), Kind: BUILTIN_ERROR}
+		}
+	}()
+	ret = b.Fn(args...)
+	err, ok := ret.(*Error)
+	if !ok || err.Caught {
+		return ret, nil
+	}
+	if b.ErrorValues {
+		return err.Catch(), nil
+	}
+	// raise a copy, the error may be shared by the builtin
+	return nil, &Error{Message: err.Message, Kind: err.Kind, Value: err.Value}
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -212,6 +389,19 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey of an integral float is the key of the equal integer, since
+// 1 == 1.0 they must find the same pair
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+		i, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInt{Value: i}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -253,7 +443,48 @@ type Hashable interface {
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
-	NumParameters int // 形参个数
+	NumParameters int      // 形参个数
+	Name          string   // the name it is bound to, empty when anonymous
+	Parameters    []string // the names of the parameters
+	Pos, End      token.Position
+	Lines         []SourcePos // line table, sorted by PC
+	Handlers      []Handler   // handler table, inner handlers first
+}
+
+// Handler is an entry of a handler table: an exception raised by the
+// instructions from Start up to End jump to Target, the stack holding
+// Depth values above the locals and the exception on top
+type Handler struct {
+	Start, End int
+	Target     int
+	Depth      int
+}
+
+// HandlerAt return the first handler covering pc
+func (cf *CompiledFunction) HandlerAt(pc int) (Handler, bool) {
+	for _, h := range cf.Handlers {
+		if h.Start <= pc && pc < h.End {
+			return h, true
+		}
+	}
+	return Handler{}, false
+}
+
+// SourcePos is an entry of a line table: the instructions from PC up to
+// the next entry come from the source at Pos
+type SourcePos struct {
+	PC  int
+	Pos token.Position
+}
+
+// PosAt return the source position of the instruction at pc, an invalid
+// position when it is not known
+func (cf *CompiledFunction) PosAt(pc int) token.Position {
+	i := sort.Search(len(cf.Lines), func(i int) bool { return cf.Lines[i].PC > pc })
+	if i == 0 {
+		return token.Position{}
+	}
+	return cf.Lines[i-1].Pos
 }
 
 var _ Object = &CompiledFunction{}
@@ -263,20 +494,66 @@ func (cf *CompiledFunction) Type() ObjectType {
 }
 
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return inspectFunction(cf.Name, cf.Parameters)
 }
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Upvalue
 }
 
 var _ Object = &Closure{}
 
+// Upvalue is a variable captured by a closure. While the variable is
+// alive on the stack of the VM the upvalue point to its slot (open), so
+// the closure and the defining function see each other's writes. When the
+// function return the value is moved into the upvalue itself (closed).
+type Upvalue struct {
+	Location *Object
+	closed   Object
+}
+
+// NewUpvalue return an open upvalue for the given stack slot
+func NewUpvalue(slot *Object) *Upvalue {
+	return &Upvalue{Location: slot}
+}
+
+// ClosedUpvalue return an upvalue holding val, not bound to any slot
+func ClosedUpvalue(val Object) *Upvalue {
+	u := &Upvalue{closed: val}
+	u.Location = &u.closed
+	return u
+}
+
+func (u *Upvalue) Get() Object {
+	return *u.Location
+}
+
+func (u *Upvalue) Set(val Object) {
+	*u.Location = val
+}
+
+// Close copy the value out of the stack slot, the slot can be reused
+func (u *Upvalue) Close() {
+	u.closed = *u.Location
+	u.Location = &u.closed
+}
+
+func (u *Upvalue) Type() ObjectType {
+	return UPVALUE_OBJ
+}
+
+func (u *Upvalue) Inspect() string {
+	if v := u.Get(); v != nil {
+		return v.Inspect()
+	}
+	return "nil"
+}
+
 func (c *Closure) Type() ObjectType {
 	return CLOSURE_OBJ
 }
 
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", c)
+	return c.Fn.Inspect()
 }
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
+
+// MaxErrors is the number of errors after which the parser give up
+const MaxErrors = 10
+
+// ParseError is a syntax error found by the parser
+type ParseError struct {
+	Pos      token.Position
+	Expected []token.TokenType // the tokens that could be at Pos, may be empty
+	Actual   token.Token       // the token found at Pos
+	Msg      string
+	Hint     string // how to fix it, may be empty
+}
+
+func (e *ParseError) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s; hint: %s", e.Pos, e.Msg, e.Hint)
+}
+
+// ParseErrors return the errors found by ParseProgram
+func (p *Parser) ParseErrors() []*ParseError {
+	return p.errors
+}
+
+// Errors return the messages of the errors found by ParseProgram
+func (p *Parser) Errors() []string {
+	msgs := make([]string, 0, len(p.errors))
+	for _, err := range p.errors {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// addError record err, the parsing of the statement goes on. Nothing is
+// recorded while recovering from a previous error.
+func (p *Parser) addError(err *ParseError) {
+	if p.panicking || p.stopped {
+		return
+	}
+	p.errors = append(p.errors, err)
+	if len(p.errors) == MaxErrors {
+		p.errors = append(p.errors, &ParseError{
+			Pos:    err.Pos,
+			Actual: err.Actual,
+			Msg:    "too many errors",
+		})
+		// 之后 nextToken 只给出 EOF，所有的循环都会结束
+		p.stopped = true
+	}
+}
+
+// fail record err and enter panic mode, the errors that follow are
+// ignored until the statement is skipped by synchronize
+func (p *Parser) fail(err *ParseError) {
+	p.addError(err)
+	p.panicking = true
+	p.errToken = err.Actual
+}
+
+// expectedError report that peek is not one of expected
+func (p *Parser) expectedError(hint string, expected ...token.TokenType) {
+	names := make([]string, len(expected))
+	for i, t := range expected {
+		names[i] = string(t)
+	}
+	want := names[0]
+	if n := len(names); n > 1 {
+		want = strings.Join(names[:n-1], ", ") + " or " + names[n-1]
+	}
+	p.fail(&ParseError{
+		Pos:      p.peekToken.Pos,
+		Expected: expected,
+		Actual:   p.peekToken,
+		Msg:      fmt.Sprintf("expected next token to be %s, got %s instead", want, p.peekToken.Type),
+		Hint:     hint,
+	})
+}
+
+// statementStart are the keywords synchronize stop before
+var statementStart = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.THROW:    true,
+	token.TRY:      true,
+}
+
+// synchronize leave panic mode after a broken statement, skipping to its
+// ';' or before the '}' closing the block or the keyword of the next
+// statement. It return true when the statement stopped on the '}' or EOF
+// closing the block, that token is not passed.
+func (p *Parser) synchronize() bool {
+	p.panicking = false
+	if p.curToken.Pos == p.errToken.Pos {
+		if p.curTokenIs(token.EOF) || p.curTokenIs(token.RBRACE) && p.depth < p.blockDepth {
+			return true
+		}
+	}
+	for !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.EOF) {
+		// the { and } of the broken statement are skipped together
+		if p.depth == p.blockDepth && (p.curTokenIs(token.SEMICOLON) ||
+			p.peekTokenIs(token.RBRACE) || statementStart[p.peekToken.Type]) {
+			break
+		}
+		p.nextToken()
+	}
+	return false
+}
@@ -11,11 +11,19 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	LESSGREATER
+	BIT_OR
+	BIT_XOR
+	BIT_AND
+	SHIFT
 	SUM
 	PRODUCT
 	PREFIX
+	POWER // higher than PREFIX, -2 ** 2 is -(2 ** 2)
 	CALL
 	INDEX
 )
@@ -23,16 +31,37 @@ const (
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.ASSIGN:   ASSIGN,
+	token.OR:       LOGICAL_OR,
+	token.AND:      LOGICAL_AND,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+	token.BIT_OR:   BIT_OR,
+	token.BIT_XOR:  BIT_XOR,
+	token.BIT_AND:  BIT_AND,
+	token.SHL:      SHIFT,
+	token.SHR:      SHIFT,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.POWER:    POWER,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 }
 
+// Precedence return the binding power of the infix operator t, LOWEST
+// when t is not an infix operator
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
@@ -43,7 +72,13 @@ type Parser struct {
 
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []*ParseError
+	panicking bool        // recovering from an error, see synchronize
+	errToken  token.Token // where the last error was found
+	stopped   bool        // MaxErrors reached
+	depth     int         // number of { not closed before curToken
+	// depth inside the block being parsed, a } at this depth close it
+	blockDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -75,7 +110,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.nextToken()
@@ -83,16 +118,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parserBoolean)
 	p.registerPrefix(token.FALSE, p.parserBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -103,6 +143,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 	// funcall
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	// array index
@@ -111,18 +163,23 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
-}
-
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
-}
-
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if p.stopped {
+		p.peekToken = token.Token{Type: token.EOF, Pos: p.curToken.End, End: p.curToken.End}
+	} else {
+		p.peekToken = p.l.NextToken()
+	}
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		// a stray } close nothing
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -133,6 +190,10 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		// a stray } is skipped
+		if p.panicking {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
@@ -142,9 +203,33 @@ func (p *Parser) ParseProgram() *ast.Program {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		// no typed nil in the interface
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
 	default:
 		return p.parseExpressionStatment()
 	}
@@ -188,12 +273,22 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Value: p.curToken.Literal,
 	}
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.peekTokenIs(token.ASSIGN) {
+		hint := ""
+		if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.EOF) {
+			hint = "a let statement need a value: let " + stmt.Name.Value + " = ..."
+		}
+		p.expectedError(hint, token.ASSIGN)
 		return nil
 	}
+	p.nextToken()
 	// pass '='
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	// 函数知道自己的名字，才能在函数体里引用自己
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -214,13 +309,41 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		p.nextToken()
 		return true
 	}
-	p.peekError(t)
+	p.expectedError("", t)
+	return false
+}
+
+// expectSeparator pass the ',' after an item of a list, or let the end of
+// the list for the caller
+func (p *Parser) expectSeparator(end token.TokenType) bool {
+	if p.peekTokenIs(end) {
+		return true
+	}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		return true
+	}
+	hint := ""
+	if p.prefixParseFns[p.peekToken.Type] != nil {
+		hint = "missing , before " + p.peekToken.Literal
+	}
+	p.expectedError(hint, token.COMMA, end)
 	return false
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s  found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseFnError(t token.TokenType, hint string) {
+	p.fail(&ParseError{
+		Pos:    p.curToken.Pos,
+		Actual: p.curToken,
+		Msg:    fmt.Sprintf("no prefix parse function for %s found", t),
+		Hint:   hint,
+	})
+}
+
+// parseIllegal report the lexer error carried by an ILLEGAL token
+func (p *Parser) parseIllegal() ast.Expression {
+	p.fail(&ParseError{Pos: p.curToken.Pos, Actual: p.curToken, Msg: p.curToken.Literal})
+	return nil
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -230,14 +353,40 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("count not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := fmt.Sprintf("invalid integer literal %q", p.curToken.Literal)
+		if isRangeError(err) {
+			msg = fmt.Sprintf("integer literal out of range: %s does not fit in 64 bits", p.curToken.Literal)
+		}
+		// the literal is skipped, the parsing is not lost
+		p.addError(&ParseError{Pos: p.curToken.Pos, Actual: p.curToken, Msg: msg})
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{
+		Token: p.curToken,
+	}
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid float literal %q", p.curToken.Literal)
+		if isRangeError(err) {
+			msg = fmt.Sprintf("float literal out of range: %s", p.curToken.Literal)
+		}
+		p.addError(&ParseError{Pos: p.curToken.Pos, Actual: p.curToken, Msg: msg})
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
 
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	// defer untrace(trace("parseInfixExpression"))
 	expression := &ast.InfixExpression{
@@ -247,12 +396,44 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.POWER) {
+		// right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:  p.curToken,
+		Target: target,
+	}
+	p.nextToken()
+	// right associative, a = b = 2 assign both
+	expression.Value = p.parseExpression(LOWEST)
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		// a nil target already reported its own error. The target is not
+		// printed, after an error its children may be nil.
+		if target != nil {
+			p.addError(&ParseError{
+				Pos:    target.Pos(),
+				Actual: expression.Token,
+				Msg:    "invalid assignment target",
+				Hint:   "only a variable or an index can be assigned",
+			})
+		}
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	// defer untrace(trace("parsePrefixExpression"))
 	expression := &ast.PrefixExpression{
@@ -276,7 +457,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	// defer untrace(trace("parseExpression"))
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
+		p.noPrefixParseFnError(p.curToken.Type, "")
 		return nil
 	}
 	leftExp := prefix()
@@ -334,6 +515,15 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		// pass else
 		p.nextToken()
+		if p.peekTokenIs(token.IF) {
+			// else if, the nested if is the only statement of the alternative
+			p.nextToken()
+			expression.Alternative = p.parseElseIf()
+			if expression.Alternative == nil {
+				return nil
+			}
+			return expression
+		}
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -343,20 +533,336 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseElseIf parse the if after an else, wrapped in a block
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	ifToken := p.curToken
+	nested, ok := p.parseIfExpression().(*ast.IfExpression)
+	if !ok {
+		return nil
+	}
+	block := &ast.BlockStatement{
+		Token: ifToken,
+		Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: ifToken, Expression: nested},
+		},
+	}
+	// the block end with the last block of the chain
+	if nested.Alternative != nil {
+		block.EndToken = nested.Alternative.EndToken
+	} else {
+		block.EndToken = nested.Consequence.EndToken
+	}
+	return block
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	// pass the (
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		// pass { or ,
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+		if !p.expectSeparator(token.RBRACE) {
+			return nil
+		}
+	}
+	// pass the final }
+	p.nextToken()
+	expression.EndToken = p.curToken
+
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+	arm.Pattern = p.parsePattern()
+	if arm.Pattern == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.IF) {
+		// pass if
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	arm.Token = p.curToken
+	// pass =>
+	p.nextToken()
+	arm.Body = p.parseExpression(LOWEST)
+
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE:
+		value := p.prefixParseFns[p.curToken.Type]()
+		if value == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: value}
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			break
+		}
+		minus := p.curToken
+		p.nextToken()
+		number := p.prefixParseFns[p.curToken.Type]()
+		if number == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Value: &ast.PrefixExpression{Token: minus, Operator: "-", Right: number}}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	p.fail(&ParseError{
+		Pos:    p.curToken.Pos,
+		Actual: p.curToken,
+		Msg:    fmt.Sprintf("invalid pattern %s", p.curToken.Literal),
+		Hint:   "a pattern is _, a name, a literal, an array or a hash pattern",
+	})
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		// pass [ or ,
+		p.nextToken()
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+		if !p.expectSeparator(token.RBRACKET) {
+			return nil
+		}
+	}
+	// pass the final ]
+	p.nextToken()
+	pattern.EndToken = p.curToken
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		// pass { or ,
+		p.nextToken()
+		keyPattern := p.parsePattern()
+		if keyPattern == nil {
+			return nil
+		}
+		key, ok := keyPattern.(*ast.LiteralPattern)
+		if !ok {
+			p.fail(&ParseError{
+				Pos:    keyPattern.Pos(),
+				Actual: p.curToken,
+				Msg:    fmt.Sprintf("hash pattern key must be a literal, got %s", keyPattern.String()),
+			})
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		// pass :
+		p.nextToken()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Keys = append(pattern.Keys, key.Value)
+		pattern.Values = append(pattern.Values, value)
+		if !p.expectSeparator(token.RBRACE) {
+			return nil
+		}
+	}
+	// pass the final }
+	p.nextToken()
+	pattern.EndToken = p.curToken
+
+	return pattern
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	// pass the (
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	// a ; after the block is allowed, as after an if
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	// pass the in
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	// a ; after the block is allowed, as after an if
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{
+		Token: p.curToken,
+	}
+	// pass token 'throw'
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTryStatement() ast.Statement {
+	stmt := &ast.TryStatement{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		p.expectedError("a try need a catch or a finally", token.CATCH, token.FINALLY)
+		return nil
+	}
+	// a ; after the block is allowed, as after an if
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{
 		Token: p.curToken,
 	}
 	block.Statements = []ast.Statement{}
+	outer := p.blockDepth
+	p.blockDepth = p.depth
+	defer func() { p.blockDepth = outer }()
 	// pass {
 	p.nextToken()
-	for !p.curTokenIs(token.RBRACE) {
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.panicking && p.synchronize() {
+			break
+		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) && p.errToken.Type != token.EOF {
+		p.fail(&ParseError{
+			Pos:      p.curToken.Pos,
+			Expected: []token.TokenType{token.RBRACE},
+			Actual:   p.curToken,
+			Msg:      "expected next token to be }, got EOF instead",
+			Hint:     fmt.Sprintf("the { at %s is not closed", block.Token.Pos),
+		})
+	}
+	block.EndToken = p.curToken
 	return block
 }
 
@@ -378,6 +884,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.peekTokenIs(token.RPAREN) {
@@ -417,6 +941,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	}
 	// exp.Arguments = p.parseCallArguments()
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.EndToken = p.curToken
 	return exp
 }
 
@@ -451,6 +976,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.EndToken = p.curToken
 
 	return array
 }
@@ -472,11 +998,17 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		p.nextToken()
 		// sit on the next
 		p.nextToken()
+		if p.curTokenIs(end) {
+			p.noPrefixParseFnError(end, "no trailing comma in a list")
+			return nil
+		}
 		list = append(list, p.parseExpression(LOWEST))
 	}
-	if !p.expectPeek(end) {
+	if !p.expectSeparator(end) {
 		return nil
 	}
+	// pass the end
+	p.nextToken()
 
 	return list
 }
@@ -493,6 +1025,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.EndToken = p.curToken
 
 	return exp
 }
@@ -513,7 +1046,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
-		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+		if !p.expectSeparator(token.RBRACE) {
 			return nil
 		}
 	}
@@ -521,6 +1054,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.EndToken = p.curToken
 
 	return hash
 }
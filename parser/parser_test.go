@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -125,6 +127,199 @@ return 8888;
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; break; continue; };`
+	l := lexer.New(input)
+	p := New(l)
+
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	if len(prog.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(prog.Statements))
+	}
+	stmt, ok := prog.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", prog.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2]) { x };`
+	l := lexer.New(input)
+	p := New(l)
+
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	if len(prog.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(prog.Statements))
+	}
+	stmt, ok := prog.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ForStatement. got=%T", prog.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if _, ok := stmt.Iterable.(*ast.ArrayLiteral); !ok {
+		t.Errorf("stmt.Iterable is not ast.ArrayLiteral. got=%T", stmt.Iterable)
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if stmt.String() != "for(x in [1, 2]) x" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { f(); } catch (e) { puts(e); };`, "try f() catch (e) puts(e)"},
+		{`try { f(); } finally { g(); }`, "try f() finally g()"},
+		{`try { throw 1 } catch (e) { e } finally { g() }`, "try throw 1; catch (e) e finally g()"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		prog := p.ParseProgram()
+		checkParseError(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(prog.Statements))
+		}
+		stmt, ok := prog.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.TryStatement. got=%T", prog.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	input := `throw "boom";`
+	l := lexer.New(input)
+	p := New(l)
+
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	stmt, ok := prog.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", prog.Statements[0])
+	}
+	str, ok := stmt.Value.(*ast.StringLiteral)
+	if !ok || str.Value != "boom" {
+		t.Errorf("stmt.Value is not \"boom\". got=%T(%s)", stmt.Value, stmt.Value)
+	}
+}
+
+func TestElseIfExpression(t *testing.T) {
+	input := `if (a) { 1 } else if (b) { 2 } else { 3 }`
+	l := lexer.New(input)
+	p := New(l)
+
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	stmt, ok := prog.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", prog.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statement. got=%+v", exp.Alternative)
+	}
+	inner, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("alternative is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
+	}
+	elseIf, ok := inner.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not ast.IfExpression. got=%T", inner.Expression)
+	}
+	if !testIdentifier(t, elseIf.Condition, "b") {
+		return
+	}
+	if elseIf.Alternative == nil {
+		t.Fatalf("else if has no alternative")
+	}
+	if exp.String() != "ifa 1else ifb 2else 3" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (v) { 0 => "zero", -1 => "neg", [x, _] if x > 1 => x, {"k": y} => y, n => n }`
+	l := lexer.New(input)
+	p := New(l)
+
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	stmt, ok := prog.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", prog.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Value, "v") {
+		return
+	}
+	if len(exp.Arms) != 5 {
+		t.Fatalf("exp.Arms is not 5 arms. got=%d", len(exp.Arms))
+	}
+
+	patterns := []struct {
+		pattern  ast.Pattern
+		hasGuard bool
+	}{
+		{&ast.LiteralPattern{}, false},
+		{&ast.LiteralPattern{}, false},
+		{&ast.ArrayPattern{}, true},
+		{&ast.HashPattern{}, false},
+		{&ast.BindingPattern{}, false},
+	}
+	for i, tt := range patterns {
+		arm := exp.Arms[i]
+		if fmt.Sprintf("%T", arm.Pattern) != fmt.Sprintf("%T", tt.pattern) {
+			t.Errorf("arm %d pattern wrong. expected=%T, got=%T", i, tt.pattern, arm.Pattern)
+		}
+		if (arm.Guard != nil) != tt.hasGuard {
+			t.Errorf("arm %d guard wrong. expected=%t, got=%v", i, tt.hasGuard, arm.Guard)
+		}
+	}
+
+	expected := `match(v) { 0 => zero, (-1) => neg, [x, _] if (x > 1) => x, {k: y} => y, n => n }`
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. expected=%q, got=%q", expected, exp.String())
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := `foobar;`
 	l := lexer.New(input)
@@ -178,6 +373,87 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0XFF_FF", 65535},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"9223372036854775807", 9223372036854775807},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		prog := p.ParseProgram()
+		checkParseError(t, p)
+
+		stmt := prog.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestInvalidNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"9223372036854775808", "1:1: integer literal out of range: 9223372036854775808 does not fit in 64 bits"},
+		{"0xFFFFFFFFFFFFFFFFF", "1:1: integer literal out of range: 0xFFFFFFFFFFFFFFFFF does not fit in 64 bits"},
+		{"1 + 0b102", `1:5: invalid integer literal "0b102"`},
+		{"0x", `1:1: invalid integer literal "0x"`},
+		{"1__0", `1:1: invalid integer literal "1__0"`},
+		{"1e400", "1:1: float literal out of range: 1e400"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 error for %q, got=%v", tt.input, errors)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5e-1;"
+	l := lexer.New(input)
+	p := New(l)
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+	if len(prog.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(prog.Statements))
+	}
+	stmt, ok := prog.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", prog.Statements[0])
+	}
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 0.25 {
+		t.Errorf("literal.Value not %g. got=%g", 0.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "2.5e-1" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "2.5e-1", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -407,6 +683,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"a + b % c ** d ** e",
+			"(a + (b % (c ** (d ** e))))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a | b ^ c & d << e + f",
+			"(a | (b ^ (c & (d << (e + f)))))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"~a >> b",
+			"((~a) >> b)",
+		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"a[0] = b[1] = c || d",
+			"((a[0]) = ((b[1]) = (c || d)))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"!a && -b < c",
+			"((!a) && ((-b) < c))",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -675,6 +995,41 @@ func TestIfString(t *testing.T) {
 	// fmt.Println(program.String())
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParseError(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d", len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -1081,3 +1436,204 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, [2, 3][0]);`
+	l := lexer.NewFile("pos.mk", input)
+	p := New(l)
+	prog := p.ParseProgram()
+	checkParseError(t, p)
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{prog, "pos.mk:1:1", "pos.mk:4:18"},
+		{prog.Statements[0], "pos.mk:1:1", "pos.mk:3:2"},
+		{prog.Statements[0].(*ast.LetStatement).Value, "pos.mk:1:11", "pos.mk:3:2"},
+		{prog.Statements[1], "pos.mk:4:1", "pos.mk:4:18"},
+	}
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedStart {
+			t.Errorf("tests[%d] - wrong start. expected=%s, got=%s", i, tt.expectedStart, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] - wrong end. expected=%s, got=%s", i, tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let = 5;", "err.mk:1:5: expected next token to be IDENT, got = instead"},
+		{"let x = 5;\n  ;", "err.mk:2:3: no prefix parse function for ; found"},
+		{"let x = 5; /* oops", "err.mk:1:12: unterminated block comment"},
+		{"let x = #;", "err.mk:1:9: illegal character '#'"},
+		{`let s = "abc`, "err.mk:1:9: unterminated string literal"},
+		{"1 + 2 = 3;", "err.mk:1:1: invalid assignment target; hint: only a variable or an index can be assigned"},
+		{"match (x) { (1) => 1 }", "err.mk:1:13: invalid pattern (; hint: a pattern is _, a name, a literal, an array or a hash pattern"},
+		{"match (x) { {k: 1} => 1 }", "err.mk:1:14: hash pattern key must be a literal, got k"},
+		{"match (x) { 1 => 1", "err.mk:1:19: expected next token to be , or }, got EOF instead"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewFile("err.mk", tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("no parser error for %q", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{
+			"let = 5; let y = ; let z = 3;",
+			[]string{
+				"1:5: expected next token to be IDENT, got = instead",
+				"1:18: no prefix parse function for ; found",
+			},
+		},
+		// 函数体里的错误不影响外面
+		{
+			"let f = fn(x) { let = 1; x }; let g = ;",
+			[]string{
+				"1:21: expected next token to be IDENT, got = instead",
+				"1:39: no prefix parse function for ; found",
+			},
+		},
+		// 出错的语句里的 { } 一起跳过
+		{
+			`let b = {"a" 1}; let c = [1 2, fn() { let x = 1; }]; let d = 3`,
+			[]string{
+				"1:14: expected next token to be :, got INT instead",
+				"1:29: expected next token to be , or ], got INT instead; hint: missing , before 2",
+			},
+		},
+		{
+			"if (x { 1 } let y = ;",
+			[]string{
+				"1:7: expected next token to be ), got { instead",
+				"1:21: no prefix parse function for ; found",
+			},
+		},
+		{
+			"let f = fn() { 1 }}; let y = 1",
+			[]string{"1:19: no prefix parse function for } found"},
+		},
+		{
+			"puts(1, 2,); let x",
+			[]string{
+				"1:11: no prefix parse function for ) found; hint: no trailing comma in a list",
+				"1:19: expected next token to be =, got EOF instead; hint: a let statement need a value: let x = ...",
+			},
+		},
+		// 不会在 EOF 处死循环
+		{
+			"let f = fn() { 1",
+			[]string{"1:17: expected next token to be }, got EOF instead; hint: the { at 1:14 is not closed"},
+		},
+		{
+			"while (true) { let x = 1 + ",
+			[]string{"1:28: no prefix parse function for EOF found"},
+		},
+		{
+			"try { 1 } let x = 1; try { 2 } catch e { 3 }",
+			[]string{
+				"1:11: expected next token to be CATCH or FINALLY, got LET instead; hint: a try need a catch or a finally",
+				"1:38: expected next token to be (, got IDENT instead",
+			},
+		},
+		// the broken target is not printed
+		{
+			"1 + ) = 2; let x = ;",
+			[]string{
+				"1:5: no prefix parse function for ) found",
+				"1:20: no prefix parse function for ; found",
+			},
+		},
+		{
+			"fn() { 1 + ; 2 } = 3;",
+			[]string{
+				"1:12: no prefix parse function for ; found",
+				"1:1: invalid assignment target; hint: only a variable or an index can be assigned",
+			},
+		},
+		{
+			"1 + 0b102 + 0x;",
+			[]string{`1:5: invalid integer literal "0b102"`, `1:13: invalid integer literal "0x"`},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q", tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestParseErrorFields(t *testing.T) {
+	l := lexer.NewFile("err.mk", "let a = [1 2];")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%v", p.Errors())
+	}
+	err := errors[0]
+	if err.Pos.String() != "err.mk:1:12" {
+		t.Errorf("wrong position. got=%s", err.Pos)
+	}
+	if len(err.Expected) != 2 || err.Expected[0] != token.COMMA || err.Expected[1] != token.RBRACKET {
+		t.Errorf("wrong expected tokens. got=%v", err.Expected)
+	}
+	if err.Actual.Type != token.INT || err.Actual.Literal != "2" {
+		t.Errorf("wrong actual token. got=%v", err.Actual)
+	}
+	if err.Hint != "missing , before 2" {
+		t.Errorf("wrong hint. got=%q", err.Hint)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", MaxErrors+5)
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != MaxErrors+1 {
+		t.Fatalf("wrong number of errors. want=%d, got=%d", MaxErrors+1, len(errors))
+	}
+	expected := fmt.Sprintf("%d:5: too many errors", MaxErrors)
+	if errors[MaxErrors] != expected {
+		t.Errorf("wrong last error. want=%q, got=%q", expected, errors[MaxErrors])
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -33,6 +34,7 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalSize)
 	symbolTable := compiler.NewSymbolTable()
+	macroEnv := object.NewEnvironment()
 
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
@@ -55,8 +57,16 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		// 宏展开在解析和编译之间
+		evaluator.DefineMacros(prog, macroEnv)
+		prog, err := evaluator.ExpandMacros(prog, macroEnv)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Macro expansion failed:\n %s \n", err)
+			continue
+		}
+
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(prog)
+		err = comp.Compile(prog)
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s \n", err)
 			continue
@@ -71,7 +81,11 @@ func Start(in io.Reader, out io.Writer) {
 			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s \n", err)
 			continue
 		}
+		// 只定义了宏的一行什么都没执行
 		stackTop := machine.LastPoppedStackElem()
+		if stackTop == nil {
+			continue
+		}
 		io.WriteString(out, stackTop.Inspect())
 		io.WriteString(out, "\n")
 
@@ -1,13 +1,19 @@
 package token
 
+import (
+	"fmt"
+)
+
 type TokenType string
 
 const (
-	EOF     = "EOF"
+	EOF = "EOF"
+	// ILLEGAL token carry the description of the problem as its literal
 	ILLEGAL = "ILLEGAL"
 
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
 	LET      = "LET"
@@ -15,6 +21,17 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	MATCH    = "MATCH"
+	MACRO    = "MACRO"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 
@@ -27,25 +44,86 @@ const (
 	RPAREN    = ")"
 	LBRACKET  = "["
 	RBRACKET  = "]"
+	ARROW     = "=>"
 
 	// operator
 	PLUS     = "+"
 	MINUS    = "-"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 	ASSIGN   = "="
 	BANG     = "!"
 
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
+
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
+
+	AND = "&&"
+	OR  = "||"
 )
 
+// Position is a location in the source, line and column start from 1
+type Position struct {
+	File   string // file name, may be empty
+	Offset int    // byte offset, starting from 0
+	Line   int
+	Column int
+}
+
+// IsValid report whether the position is set
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String return file:line:col, or line:col when there is no file name
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// TriviaKind is the kind of source text between tokens
+type TriviaKind int
+
+const (
+	Whitespace TriviaKind = iota
+	LineComment
+	BlockComment
+)
+
+// Trivia is whitespace or comment, the lexer only keep them on demand
+type Trivia struct {
+	Kind TriviaKind
+	Text string // raw text, comment markers included
+	Pos  Position
+}
+
 // Token represent the token
 type Token struct {
 	Type    TokenType // token type, ident or integer
 	Literal string    // literal value of this token
+	Pos     Position  // position of the first character
+	End     Position  // position right after the last character
+	Leading []Trivia  // trivia right before this token, see lexer.ScanTrivia
 }
 
 var keywords = map[string]TokenType{
@@ -56,6 +134,18 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"match":    MATCH,
+	"macro":    MACRO,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
 }
 
 func LookupIdent(ident string) TokenType {
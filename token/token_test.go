@@ -15,3 +15,19 @@ func TestToken(t *testing.T) {
 		}
 	}
 }
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{}, "-"},
+		{Position{Line: 3, Column: 7}, "3:7"},
+		{Position{File: "a.mk", Line: 3, Column: 7}, "a.mk:3:7"},
+	}
+	for _, tt := range tests {
+		if tt.pos.String() != tt.expected {
+			t.Errorf("wrong position string. expected=%q, got=%q", tt.expected, tt.pos.String())
+		}
+	}
+}
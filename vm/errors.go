@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"monkey/token"
+)
+
+var (
+	// too many nested calls or values, whichever limit is hit first
+	errStackOverflow  = errors.New("stack overflow")
+	errStackUnderflow = errors.New("stack underflow")
+)
+
+// RuntimeError is an error raised by the running program, with the call
+// stack at that time
+type RuntimeError struct {
+	Msg    string
+	Frames []StackFrame // innermost first
+}
+
+// StackFrame is a function being run and where it is
+type StackFrame struct {
+	Function string
+	Pos      token.Position // invalid when the line table does not know
+}
+
+// Error print the message and the traceback, one frame per line. The
+// same frame repeated, by a deep recursion, is printed once.
+func (e *RuntimeError) Error() string {
+	var out bytes.Buffer
+	out.WriteString(e.Msg)
+	for i := 0; i < len(e.Frames); {
+		f := e.Frames[i]
+		n := 1
+		for i+n < len(e.Frames) && e.Frames[i+n] == f {
+			n++
+		}
+		out.WriteString("\n    at " + f.Function)
+		if f.Pos.IsValid() {
+			out.WriteString(" (" + f.Pos.String() + ")")
+		}
+		if n > 1 {
+			out.WriteString(fmt.Sprintf("\n    ... repeated %d more times", n-1))
+		}
+		i += n
+	}
+	return out.String()
+}
+
+// Name return the name of the function of the frame
+func (f *Frame) Name() string {
+	if f.cl.Fn.Name != "" {
+		return f.cl.Fn.Name
+	}
+	return "<anonymous>"
+}
+
+// Pos return the source position of the instruction being run
+func (f *Frame) Pos() token.Position {
+	pc := f.pc
+	if pc < 0 {
+		pc = 0
+	}
+	return f.cl.Fn.PosAt(pc)
+}
+
+// panicError is the error for a value recovered from a panic
+func panicError(r interface{}) error {
+	if r == errStackUnderflow {
+		return errStackUnderflow
+	}
+	return fmt.Errorf("internal error: %v", r)
+}
+
+// runtimeError wrap err with the current call stack
+func (vm *VM) runtimeError(err error) *RuntimeError {
+	if rerr, ok := err.(*RuntimeError); ok {
+		return rerr
+	}
+	frames := make([]StackFrame, 0, vm.frameIndex+1)
+	// 内置函数没有自己的帧，位置是调用它的地方
+	if t, ok := err.(*thrown); ok && t.builtin != "" {
+		frames = append(frames, StackFrame{Function: t.builtin, Pos: vm.currentFrame().Pos()})
+	}
+	for i := vm.frameIndex - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		frames = append(frames, StackFrame{Function: f.Name(), Pos: f.Pos()})
+	}
+	return &RuntimeError{Msg: err.Error(), Frames: frames}
+}
+
+// thrown is an error raised with a value, by throw or by a builtin
+type thrown struct {
+	err     *object.Error
+	builtin string // the builtin returning err, empty for a throw
+}
+
+func (t *thrown) Error() string {
+	return t.err.Message
+}
+
+// throwError return the error raising value, an error raised again keep
+// its message
+func throwError(value object.Object) error {
+	if err, ok := value.(*object.Error); ok {
+		return &thrown{err: &object.Error{Message: err.Message, Kind: err.Kind, Value: err.Value}}
+	}
+	return &thrown{err: &object.Error{Message: "uncaught exception: " + value.Inspect(), Value: value}}
+}
+
+// handle unwind the frames to the innermost handler covering the running
+// instructions and give it err, the stack is cut to the depth of the
+// handler. It return false when no handler is found, the frames are
+// left as they are for the traceback.
+func (vm *VM) handle(err error) bool {
+	i := vm.frameIndex - 1
+	var handler object.Handler
+	for ; i >= 0; i-- {
+		h, ok := vm.frames[i].cl.Fn.HandlerAt(vm.frames[i].pc)
+		if ok {
+			handler = h
+			break
+		}
+	}
+	if i < 0 {
+		return false
+	}
+
+	for vm.frameIndex > i+1 {
+		vm.popFrame()
+	}
+	frame := vm.currentFrame()
+	vm.sp = frame.basePointer + frame.cl.Fn.NumLocals + handler.Depth
+	frame.pc = handler.Target - 1
+
+	var exception object.Object
+	if t, ok := err.(*thrown); ok {
+		exception = t.err
+		if t.err.Value != nil {
+			exception = t.err.Value
+		}
+	} else {
+		exception = &object.Error{Message: err.Error(), Kind: object.RUNTIME_ERROR}
+	}
+	if e, ok := exception.(*object.Error); ok {
+		exception = e.Catch()
+	}
+	// sp is lower than when err was raised, there is room
+	vm.stack[vm.sp] = exception
+	vm.sp++
+	return true
+}
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
@@ -32,23 +34,68 @@ type VM struct {
 	stack   []object.Object
 	sp      int // always point to next available value, top is stack[sp - 1]
 	globals []object.Object
+	// globalNames name the global slots, may be shorter than globals
+	globalNames []string
 
 	frames     []*Frame
 	frameIndex int // point to next available
+
+	// upvalues still pointing into the stack, sorted by slot
+	openUpvalues []openUpvalue
+}
+
+type openUpvalue struct {
+	slot    int
+	upvalue *object.Upvalue
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.frameIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.frameIndex >= MaxFrames {
+		return errStackOverflow
+	}
 	vm.frames[vm.frameIndex] = f
 	vm.frameIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
 	vm.frameIndex--
-	return vm.frames[vm.frameIndex]
+	frame := vm.frames[vm.frameIndex]
+	// 函数返回后局部变量的位置会被复用，被闭包捕获的变量要搬出栈
+	vm.closeUpvalues(frame.basePointer)
+	return frame
+}
+
+// captureUpvalue return the upvalue of a stack slot, a slot captured twice
+// share the same upvalue
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].slot >= slot {
+		if vm.openUpvalues[i-1].slot == slot {
+			return vm.openUpvalues[i-1].upvalue
+		}
+		i--
+	}
+
+	upvalue := object.NewUpvalue(&vm.stack[slot])
+	vm.openUpvalues = append(vm.openUpvalues, openUpvalue{})
+	copy(vm.openUpvalues[i+1:], vm.openUpvalues[i:])
+	vm.openUpvalues[i] = openUpvalue{slot: slot, upvalue: upvalue}
+	return upvalue
+}
+
+// closeUpvalues close the upvalues of the slots from base
+func (vm *VM) closeUpvalues(base int) {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].slot >= base {
+		vm.openUpvalues[i-1].upvalue.Close()
+		i--
+	}
+	vm.openUpvalues = vm.openUpvalues[:i]
 }
 
 func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
@@ -61,6 +108,9 @@ func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 func New(bytecode *compiler.Bytecode) *VM {
 	mainFn := &object.CompiledFunction{
 		Instructions: bytecode.Instructions,
+		Name:         "<main>",
+		Lines:        bytecode.Lines,
+		Handlers:     bytecode.Handlers,
 	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
@@ -74,7 +124,8 @@ func New(bytecode *compiler.Bytecode) *VM {
 		stack: make([]object.Object, StackSize),
 		sp:    0,
 
-		globals: make([]object.Object, GlobalSize),
+		globals:     make([]object.Object, GlobalSize),
+		globalNames: bytecode.GlobalNames,
 
 		frames:     frames,
 		frameIndex: 1,
@@ -90,14 +141,51 @@ func (vm *VM) StackTop() object.Object {
 }
 
 func (vm *VM) pop() object.Object {
-	// TODO: make it more safe
+	// 只有坏的字节码才会这样，run 把它变成错误
+	if vm.sp == 0 {
+		panic(errStackUnderflow)
+	}
 	o := vm.stack[vm.sp-1]
 	vm.sp--
 
 	return o
 }
 
+// Run run the bytecode, an error is returned as a *RuntimeError holding
+// the call stack
 func (vm *VM) Run() error {
+	if err := vm.run(); err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// run execute the instructions, an error raised by an instruction jump to
+// its handler when there is one
+func (vm *VM) run() error {
+	for {
+		err := vm.recoverExecute()
+		if err == nil {
+			return nil
+		}
+		if !vm.handle(err) {
+			return err
+		}
+	}
+}
+
+// recoverExecute is execute with a panic returned as an error, the host
+// process must not die with the script
+func (vm *VM) recoverExecute() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	return vm.execute()
+}
+
+func (vm *VM) execute() error {
 	var pc int
 	var ins code.Instructions
 	var op code.OpCode
@@ -117,7 +205,8 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -134,7 +223,8 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+			code.OpLessThan, code.OpLessEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -149,6 +239,11 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[pc+1:]))
 			// 因为for循环里的pc++
@@ -164,6 +259,15 @@ func (vm *VM) Run() error {
 				// 减1和上面OpJump少1一个意思
 				vm.currentFrame().pc = pos - 1
 			}
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[pc+1:]))
+			vm.currentFrame().pc += 2
+			// 条件满足就跳，值留在栈上作为整个表达式的结果，否则弹出
+			if isTruthy(vm.StackTop()) == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().pc = pos - 1
+			} else {
+				vm.pop()
+			}
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -176,6 +280,10 @@ func (vm *VM) Run() error {
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[pc+1:])
 			vm.currentFrame().pc += 2
+			// 全局变量已经声明，但它的let还没执行
+			if vm.globals[globalIndex] == nil {
+				return vm.uninitializedGlobalError(int(globalIndex))
+			}
 			err := vm.push(vm.globals[globalIndex])
 			if err != nil {
 				return err
@@ -210,6 +318,54 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+		case code.OpMatch:
+			constIndex := code.ReadUint16(ins[pc+1:])
+			vm.currentFrame().pc += 2
+
+			pattern := vm.constants[constIndex].(*object.MatchPattern)
+			values, ok := pattern.Match(vm.pop())
+			for _, v := range values {
+				err := vm.push(v)
+				if err != nil {
+					return err
+				}
+			}
+			err := vm.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpIter:
+			iterable := vm.pop()
+			iterator, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("not iterable: %s", iterable.Type())
+			}
+			err := vm.push(iterator)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[pc+1:]))
+			vm.currentFrame().pc += 2
+			iterator := vm.pop().(*object.Iterator)
+			// 迭代完了就跳出循环，否则把元素放到栈上
+			el, ok := iterator.Next()
+			if !ok {
+				vm.currentFrame().pc = pos - 1
+				break
+			}
+			err := vm.push(el)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[pc+1:])
 			// ignore the len(arg) in this instruction
@@ -298,25 +454,69 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[pc+1:])
 			vm.currentFrame().pc++
 
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex].Get())
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[pc+1:])
+			vm.currentFrame().pc++
+
+			currentClosure := vm.currentFrame().cl
+			currentClosure.Free[freeIndex].Set(vm.pop())
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[pc+1:])
+			vm.currentFrame().pc++
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.captureUpvalue(frame.basePointer + int(localIndex)))
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[pc+1:])
+			vm.currentFrame().pc++
+
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
 			}
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil {
+				return err
+			}
+		case code.OpThrow:
+			return throwError(vm.pop())
 		}
 	}
 	return nil
 }
 
+func (vm *VM) uninitializedGlobalError(index int) error {
+	if index < len(vm.globalNames) && vm.globalNames[index] != "" {
+		return fmt.Errorf("global variable %s read before initialization", vm.globalNames[index])
+	}
+	return fmt.Errorf("global variable #%d read before initialization", index)
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	fn, ok := constant.(*object.CompiledFunction)
 	if !ok {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
-	free := make([]object.Object, numFree)
+	free := make([]*object.Upvalue, numFree)
 	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		switch v := vm.stack[vm.sp-numFree+i].(type) {
+		case *object.Upvalue:
+			free[i] = v
+		default:
+			// OpCurrentClosure push the closure itself, it never change
+			free[i] = object.ClosedUpvalue(v)
+		}
 	}
 
 	vm.sp = vm.sp - numFree
@@ -340,7 +540,10 @@ func (vm *VM) executeCall(numArgs int) error {
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	ret := builtin.Fn(args...)
+	ret, err := builtin.Call(args...)
+	if err != nil {
+		return &thrown{err: err, builtin: object.BuiltinName(builtin)}
+	}
 
 	vm.sp = vm.sp - numArgs - 1
 
@@ -360,11 +563,16 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	// 	return fmt.Errorf("calling non-function")
 	// }
 	if numArgs != cl.Fn.NumParameters {
+		if cl.Fn.Name != "" {
+			return fmt.Errorf("wrong number of arguments to %s: want=%d, got=%d", cl.Fn.Name, cl.Fn.NumParameters, numArgs)
+		}
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
 
 	// this hole for local binding
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
@@ -378,6 +586,13 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 		return vm.executeArrayIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.Error).Field(index.(*object.String).Value); ok {
+			return vm.push(field)
+		}
+		return vm.push(Null)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
@@ -393,6 +608,14 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	ch, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(ch)
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -406,6 +629,30 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	return vm.push(pair.Value)
 }
 
+// executeSetIndex store value into left[index] and push value back
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d (length %d)", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return vm.push(value)
+}
+
 // buildHash build a map from stack, 这里的index和 buildArray一样，可以看下那个函数的说明
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	hashedPairs := make(map[object.HashKey]object.HashPair)
@@ -452,12 +699,31 @@ func isTruthy(obj object.Object) bool {
 
 func (vm *VM) executeMinuxOperator() error {
 	operand := vm.pop()
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		if operand.Value == math.MinInt64 {
+			return vm.push(object.NewBigInt(new(big.Int).Neg(big.NewInt(operand.Value))))
+		}
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.BigInt:
+		return vm.push(object.NewBigInt(new(big.Int).Neg(operand.Value)))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
-	value := operand.(*object.Integer).Value
+}
 
-	return vm.push(&object.Integer{Value: -value})
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: ^operand.Value})
+	case *object.BigInt:
+		return vm.push(object.NewBigInt(new(big.Int).Not(operand.Value)))
+	default:
+		return fmt.Errorf("unsupported type for bitwise not: %s", operand.Type())
+	}
 }
 
 func (vm *VM) executeBangOperator() error {
@@ -478,9 +744,15 @@ func (vm *VM) executeComparison(op code.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER_OBJ || right.Type() == object.INTEGER_OBJ {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if object.IsInteger(left) && object.IsInteger(right) {
+		return vm.executeBigIntComparison(op, left, right)
+	}
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
@@ -502,11 +774,79 @@ func (vm *VM) executeIntegerComparison(op code.OpCode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeBigIntComparison(op code.OpCode, left, right object.Object) error {
+	cmp := object.ToBigInt(left).Cmp(object.ToBigInt(right))
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp >= 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(cmp < 0))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp <= 0))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.OpCode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
 }
 
+// isNumber report whether obj is an integer or a float
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat convert a number to float64, integers are promoted
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		return object.BigIntToFloat(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -523,6 +863,10 @@ func (vm *VM) executeBinaryOperation(op code.OpCode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case object.IsInteger(left) && object.IsInteger(right):
+		return vm.executeBinaryBigIntOperation(op, object.ToBigInt(left), object.ToBigInt(right))
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -541,9 +885,86 @@ func (vm *VM) executeBinaryStringOperation(op code.OpCode, left, right object.Ob
 
 func (vm *VM) executeBinaryIntegerOperation(op code.OpCode, left, right object.Object) error {
 	var ret int64
+	var ok bool
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
 
+	switch op {
+	case code.OpAdd:
+		ret, ok = object.AddInt64(leftValue, rightValue)
+	case code.OpSub:
+		ret, ok = object.SubInt64(leftValue, rightValue)
+	case code.OpMul:
+		ret, ok = object.MulInt64(leftValue, rightValue)
+	case code.OpDiv:
+		ret, ok = object.DivInt64(leftValue, rightValue)
+	case code.OpMod:
+		ret, ok = object.ModInt64(leftValue, rightValue)
+	case code.OpPow:
+		ret, ok = object.PowInt64(leftValue, rightValue)
+	case code.OpBitAnd:
+		ret, ok = leftValue&rightValue, true
+	case code.OpBitOr:
+		ret, ok = leftValue|rightValue, true
+	case code.OpBitXor:
+		ret, ok = leftValue^rightValue, true
+	case code.OpShiftLeft:
+		ret, ok = object.ShlInt64(leftValue, rightValue)
+	case code.OpShiftRight:
+		ret, ok = object.ShrInt64(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unkown integer operation: %d", op)
+	}
+	// overflow or edge case (division by zero, negative exponent...),
+	// redo it with big integers
+	if !ok {
+		return vm.executeBinaryBigIntOperation(op, big.NewInt(leftValue), big.NewInt(rightValue))
+	}
+	return vm.push(&object.Integer{Value: ret})
+}
+
+func (vm *VM) executeBinaryBigIntOperation(op code.OpCode, left, right *big.Int) error {
+	var ret object.Object
+	var err error
+
+	switch op {
+	case code.OpAdd:
+		ret = object.NewBigInt(new(big.Int).Add(left, right))
+	case code.OpSub:
+		ret = object.NewBigInt(new(big.Int).Sub(left, right))
+	case code.OpMul:
+		ret = object.NewBigInt(new(big.Int).Mul(left, right))
+	case code.OpDiv:
+		ret, err = object.DivBigInt(left, right)
+	case code.OpMod:
+		ret, err = object.ModBigInt(left, right)
+	case code.OpPow:
+		ret, err = object.PowBigInt(left, right)
+	case code.OpBitAnd:
+		ret = object.NewBigInt(new(big.Int).And(left, right))
+	case code.OpBitOr:
+		ret = object.NewBigInt(new(big.Int).Or(left, right))
+	case code.OpBitXor:
+		ret = object.NewBigInt(new(big.Int).Xor(left, right))
+	case code.OpShiftLeft:
+		ret, err = object.ShlBigInt(left, right)
+	case code.OpShiftRight:
+		ret, err = object.ShrBigInt(left, right)
+	default:
+		return fmt.Errorf("unkown integer operation: %d", op)
+	}
+	if err != nil {
+		return err
+	}
+	return vm.push(ret)
+}
+
+func (vm *VM) executeBinaryFloatOperation(op code.OpCode, left, right object.Object) error {
+	var ret float64
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	// float follow IEEE 754, x / 0 is an infinity and x % 0 is NaN
 	switch op {
 	case code.OpAdd:
 		ret = leftValue + rightValue
@@ -553,15 +974,19 @@ func (vm *VM) executeBinaryIntegerOperation(op code.OpCode, left, right object.O
 		ret = leftValue * rightValue
 	case code.OpDiv:
 		ret = leftValue / rightValue
+	case code.OpMod:
+		ret = math.Mod(leftValue, rightValue)
+	case code.OpPow:
+		ret = math.Pow(leftValue, rightValue)
 	default:
-		return fmt.Errorf("unkown integer operation: %d", op)
+		return fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
 	}
-	return vm.push(&object.Integer{Value: ret})
+	return vm.push(&object.Float{Value: ret})
 }
 
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return errStackOverflow
 	}
 	vm.stack[vm.sp] = o
 	vm.sp++
@@ -2,11 +2,15 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +49,13 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		vm := New(comp.Bytecode())
 		err = vm.Run()
 
+		// 内置函数返回的错误会被抛出
+		if expected, ok := tt.expected.(*object.Error); ok && err != nil {
+			if runtimeErrorMessage(err) != expected.Message {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -54,6 +65,43 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
+// vmErrorTestCase 期望运行时出错，expected 只有一行时比较错误信息，
+// 有多行时比较整个 traceback（文件名是 err.mk）
+type vmErrorTestCase struct {
+	input    string
+	expected string
+}
+
+func runVmErrorTests(t *testing.T, tests []vmErrorTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parser.New(lexer.NewFile("err.mk", tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil {
+			t.Fatalf("%s: expected VM error but resulted in none", tt.input)
+		}
+		rerr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("%s: error is not a *RuntimeError. got=%T (%v)", tt.input, err, err)
+		}
+		if !strings.Contains(tt.expected, "\n") {
+			if rerr.Msg != tt.expected {
+				t.Errorf("%s: wrong VM error: want=%q, got=%q", tt.input, tt.expected, rerr.Msg)
+			}
+			continue
+		}
+		if rerr.Error() != tt.expected {
+			t.Errorf("%s: wrong traceback.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, rerr)
+		}
+	}
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -63,6 +111,16 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case *big.Int:
+		err := testBigIntObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBigIntObject failed: %s", err)
+		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -137,6 +195,36 @@ func testStringObject(expected string, actual object.Object) error {
 	return nil
 }
 
+func testBigIntObject(expected *big.Int, actual object.Object) error {
+	result, ok := actual.(*object.BigInt)
+	if !ok {
+		return fmt.Errorf("object is not BigInt. got=%T (%+v)", actual, actual)
+	}
+	if result.Value.Cmp(expected) != 0 {
+		return fmt.Errorf("object has wrong value. got=%s, want=%s", result.Value, expected)
+	}
+	return nil
+}
+
+func mustBigInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("bad big integer: " + s)
+	}
+	return v
+}
+
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -173,6 +261,429 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestIntegerOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"2 ** -1", 0.5},
+		{"2 ** 64", mustBigInt("18446744073709551616")},
+		{"(-1) ** 9223372036854775807", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 >> 100", 0},
+		{"1 << 64", mustBigInt("18446744073709551616")},
+		{"(1 << 64) >> 63", 2},
+		{"~(1 << 64)", mustBigInt("-18446744073709551617")},
+		{"(1 << 64) & 3", 0},
+		{"1 + 2 * 3 % 4", 3},
+		{"1 | 2 ^ 3 & 4 << 1", 3},
+		{"5.5 % 2", 1.5},
+		{"2.0 ** 0.5 > 1.41", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "modulo by zero"},
+		{"(1 << 64) / 0", "division by zero"},
+		{"(1 << 64) % 0", "modulo by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -1", "negative shift count: -1"},
+		{"1 << 9223372036854775807", "shift count too large: 9223372036854775807"},
+		{"1.5 & 1", "unsupported types for binary operation: FLOAT INTEGER"},
+		{"~1.5", "unsupported type for bitwise not: FLOAT"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"-2.5 - 1", -3.5},
+		{"1e3 + 2.5e-1", 1000.25},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"2.0 == 2", true},
+		{"2.5 != 2.5", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBigIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", mustBigInt("9223372036854775808")},
+		{"-9223372036854775807 - 2", mustBigInt("-9223372036854775809")},
+		{"4294967296 * 4294967296", mustBigInt("18446744073709551616")},
+		{"-(-9223372036854775807 - 1)", mustBigInt("9223372036854775808")},
+		{"(-9223372036854775807 - 1) / -1", mustBigInt("9223372036854775808")},
+		// demoted back as soon as it fits
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"(4294967296 * 4294967296) / 4294967296", 4294967296},
+		{"9223372036854775807 + 1 > 9223372036854775807", true},
+		{"9223372036854775807 + 1 == 9223372036854775806 + 2", true},
+		{"9223372036854775807 + 1 != 1", true},
+		{"(9223372036854775807 + 1) * 0.5", 4611686018427387904.0},
+		{`{9223372036854775807 + 1: 5}[9223372036854775806 + 2]`, 5},
+		{`
+let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+fact(25)`, mustBigInt("15511210043330985984000000")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+let first = fn(arr) { for (x in arr) { if (x % 2 == 0) { return x; } } -1 };
+first([1, 3, 4, 5])`, 4},
+		{`
+let first = fn(arr) { for (x in arr) { if (x % 2 == 0) { return x; } } -1 };
+first([1, 3])`, -1},
+		{`
+let f = fn() { for (x in [1, 2, 3, 4]) { if (x < 3) { continue; } return x; } };
+f()`, 3},
+		{`
+let f = fn() { for (x in [1, 2, 3]) { if (x == 1) { break; } return 99; } 7 };
+f()`, 7},
+		{`let f = fn() { while (true) { break; } 5 }; f()`, 5},
+		{`let f = fn() { while (false) { 1 } }; f()`, Null},
+		// nested loops, break only leave the inner one
+		{`
+let f = fn() {
+  for (a in [1, 2, 3]) {
+    for (b in [1, 2, 3]) { if (b > 1) { break; } }
+    if (a == 3) { return a * 10; }
+  }
+};
+f()`, 30},
+		{`
+let f = fn() { for (c in "日本") { return c; } };
+f()`, "日"},
+		// hash keys come in order
+		{`
+let f = fn() { for (k in {3: "c", 1: "a", 2: "b"}) { return k; } };
+f()`, 1},
+		// the stack stay balanced across many iterations
+		{`
+let a = "0123456789";
+let b = a + a + a + a + a + a + a + a + a + a;
+let c = b + b + b + b + b + b + b + b + b + b;
+let d = c + c + c;
+let f = fn(s) { for (ch in s) { if (len(ch) != 1) { return 1; } if (true) { 1 } } 0 };
+f(d)`, 0},
+		// at top level the loop use global variables
+		{`for (x in [1, 2]) { if (x == 2) { break; } } x`, 2},
+		// the loop variable reuse a variable of the same scope
+		{`let x = 5; let f = fn() { x }; for (x in [1, 2]) { }; x + f() * 10`, 22},
+		{`let g = fn() { let x = 5; let f = fn() { x }; for (x in [1, 2]) { }; x + f() * 10 }; g()`, 22},
+		{`let x = 5; let g = fn() { for (x in [1, 2]) { }; x }; g() + x * 10`, 52},
+		// a loop has no value
+		{`for (x in [1]) { }`, Null},
+		{`let i = 0; while (i < 1) { i = i + 1 }`, Null},
+		// break, continue and return inside an expression leave its operands
+		{`
+let i = 0; let s = 0;
+while (i < 5000) { i = i + 1; let y = 1 + if (i % 2 == 0) { continue; } else { 2 }; s = s + y };
+s`, 7500},
+		{`let s = 0; for (x in [1, 2, 3]) { s = s + [x, if (x == 2) { break; } else { x }][1] }; s`, 1},
+		{`let f = fn(x) { 1 + if (x) { return 10 } else { 2 } }; f(true) + f(false)`, 13},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[1] = 5; a", []int{1, 5, 3}},
+		{"let a = [1, 2, 3]; a[0] = a[2] = 7; a", []int{7, 2, 7}},
+		{"let a = [1, 2, 3]; a[1] = 5", 5},
+		// arrays are shared, not copied
+		{"let a = [1, 2]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {}; h[true] = 1; h[2] = 2; h[true] + h[2]`, 3},
+		{`
+let squares = fn() {
+  let arr = [0, 0, 0, 0];
+  for (x in [0, 1, 2, 3]) { arr[x] = x * x; }
+  arr
+};
+squares()`, []int{0, 1, 4, 9}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{"let a = [1, 2]; a[2] = 0", "index out of range: 2 (length 2)"},
+		{"let a = [1, 2]; a[-1] = 0", "index out of range: -1 (length 2)"},
+		{`let a = [1, 2]; a["x"] = 0`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[1]] = 0", "unusable as hash key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{`let c = 0; let inc = fn() { c = c + 1 }; inc(); inc(); c`, 2},
+		{`let x = 1; x = x + 1; x = x * 10`, 20},
+		{`
+let counter = fn() {
+  let c = 0;
+  fn() { c = c + 1; c }
+};
+let a = counter();
+let b = counter();
+a(); a();
+b();
+a() * 10 + b()`, 32},
+		// two closures share the captured variable with the defining function
+		{`
+let pair = fn() {
+  let n = 0;
+  let inc = fn() { n = n + 1 };
+  let get = fn() { n };
+  inc();
+  n = n + 10;
+  inc();
+  [get(), n]
+};
+pair()`, []int{12, 12}},
+		// the variable is still shared once the function returned
+		{`
+let make = fn() {
+  let n = 0;
+  [fn() { n = n + 1 }, fn() { n }]
+};
+let fs = make();
+fs[0](); fs[0]();
+fs[1]()`, 2},
+		// captured through an intermediate function
+		{`
+let outer = fn() {
+  let n = 1;
+  let middle = fn() { fn() { n = n * 3 } };
+  middle()();
+  n
+};
+outer()`, 3},
+		{`
+let sum = fn(arr) {
+  let total = 0;
+  for (x in arr) { total = total + x; }
+  total
+};
+sum([1, 2, 3, 4])`, 10},
+		{`
+let count = fn(n) {
+  let i = 0;
+  while (i < n) { i = i + 1; }
+  i
+};
+count(5000)`, 5000},
+		// recursive local function see its own binding
+		{`
+let f = fn() {
+  let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+  fact(5)
+};
+f()`, 120},
+		// mutually recursive local functions
+		{`
+let parity = fn(n) {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+  even(n)
+};
+parity(10)`, true},
+		{`
+let f = fn() {
+  let a = fn(n) { if (n == 0) { 0 } else { b(n) } };
+  let b = fn(n) { c(n) + 1 };
+  let c = fn(n) { a(n - 1) };
+  a(4)
+};
+f()`, 4},
+		// the group is the whole block, not only adjacent lets
+		{`
+let parity = fn(n) {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let k = 1;
+  let odd = fn(n) { if (n == 0) { false } else { even(n - k) } };
+  even(n)
+};
+parity(7)`, false},
+		{`
+let f = fn() {
+  let g = fn() { h() };
+  let h = fn() { 1 };
+  let h = fn() { 2 };
+  g()
+};
+f()`, 2},
+		// a let again change what the functions defined before see
+		{`
+let f = fn() {
+  let h = fn() { 1 };
+  let g = fn() { h() };
+  let a = g();
+  let h = fn() { 2 };
+  a * 10 + g()
+};
+f()`, 12},
+		// the helpers outlive the function defining them
+		{`
+let make = fn() {
+  let ping = fn(n) { if (n == 0) { "ping" } else { pong(n - 1) } };
+  let pong = fn(n) { if (n == 0) { "pong" } else { ping(n - 1) } };
+  ping
+};
+make()(3)`, "pong"},
+		// a closure inside the function refer to the function by name
+		{`
+let sum = fn(n) { if (n == 0) { 0 } else { let g = fn() { sum(n - 1) }; n + g() } };
+sum(4)`, 10},
+		// assigning the name change the variable, not the running function
+		{`
+let f = fn() { f = 5; 1 };
+f() + f`, 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (1) { 0 => "zero", 1 => "one", _ => "many" }`, "one"},
+		{`match (5) { 0 => "zero", 1 => "one", _ => "many" }`, "many"},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match (2.0) { 2 => "two", _ => "other" }`, "two"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (3) { 1 => 1 }`, Null},
+		{`match (7) { n => n * 2 }`, 14},
+		{`match (7) { n if n > 10 => 1, n if n > 5 => 2, _ => 3 }`, 2},
+		{`match ([1, 2]) { [] => 0, [x] => x, [x, y] => x + y }`, 3},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b * c }`, 7},
+		{`match ([1, 2, 3]) { [1, _] => 0, [1, _, z] => z }`, 3},
+		{`match ({"op": "add", "x": 1, "y": 2}) { {"op": "sub"} => 0, {"op": "add", "x": a, "y": b} => a + b }`, 3},
+		{`match ({"x": 1}) { {"y": y} => y, _ => -1 }`, -1},
+		{`match ("x") { [a] => a, {"k": v} => v, _ => 9 }`, 9},
+		{`let f = fn(v) { match (v) { [h, t] if h == 0 => t, [h, t] => f(t) + h, _ => 0 } }; f([1, [2, [0, 5]]])`, 8},
+		// the bindings do not leak out of their arm
+		{`let x = 10; match (5) { x if x > 100 => "big", _ => "small" }; x`, 10},
+		{`let x = 10; match (5) { x => x }; x`, 10},
+		{`let f = fn() { let x = 10; match (5) { x if x > 100 => 1, _ => 2 }; x }; f()`, 10},
+		{`let f = match (5) { x => fn() { x } }; let x = 1; f()`, 5},
+		{`if (false) { 1 } else if (false) { 2 } else if (true) { 3 } else { 4 }`, 3},
+		{`if (false) { 1 } else if (false) { 2 }`, Null},
+		{`let x = 5; if (x < 0) { "neg" } else if (x == 0) { "zero" } else { "pos" }`, "pos"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalForwardReferences(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = fn() { b() }; let b = fn() { 1 }; a()", 1},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let limit = 7;
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(limit)`, false},
+		{"let f = fn() { x * 2 }; let x = 21; f()", 42},
+		// let again keep the slot, closures see the new value
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let x = 1; let x = x + 1; x", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUninitializedGlobals(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{"x; let x = 1;", "global variable x read before initialization"},
+		{"let y = y + 1;", "global variable y read before initialization"},
+		{"let f = fn() { g() }; f(); let g = fn() { 1 };", "global variable g read before initialization"},
+		{"if (false) { let z = 1 }; z", "global variable z read before initialization"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestMacros(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+unless(10 > 5, "no", "yes")`, "yes"},
+		{`
+let plusOne = macro(x) { quote(fn() { let tmp = 1; unquote(x) + tmp }()) };
+let tmp = 10;
+plusOne(tmp)`, 11},
+		{`
+let rescue = macro(x) { quote(fn() { let r = 0; try { throw 1 } catch (e) { r = unquote(x) }; r }()) };
+let e = 10;
+rescue(e)`, 10},
+		{`
+let square = macro(x) { quote(unquote(x) * unquote(x)) };
+let f = fn(n) { square(n + 1) };
+f(2)`, 9},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		env := object.NewEnvironment()
+		evaluator.DefineMacros(program, env)
+		expanded, err := evaluator.ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("macro expansion error: %s", err)
+		}
+
+		comp := compiler.New()
+		err = comp.Compile(expanded)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{"for (x in 1) { }", "not iterable: INTEGER"},
+		{"for (x in true) { }", "not iterable: BOOLEAN"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -180,12 +691,36 @@ func TestBooleanExpressions(t *testing.T) {
 
 		{"1 < 2", true},
 		{"1 > 2", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1", false},
+		{"9223372036854775807 + 1 >= 1", true},
+
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 < 3", true},
+		// the result is the last evaluated operand
+		{"1 && 2", 2},
+		{"0 || 5", 0},
+		{"false || 5", 5},
+		{"if (false) { 1 } || 5", 5},
+		// short-circuit, the right side would fail
+		{"false && 1()", false},
+		{"true || 1()", true},
 		{"1 < 1", false},
 		{"1 > 1", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		// values of different types are not equal, it is not an error
+		{`1 == "a"`, false},
+		{`1 != "a"`, true},
 
 		{"true == true", true},
 		{"false == false", true},
@@ -294,7 +829,15 @@ func TestIndexExpression(t *testing.T) {
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
+		{"{1: 1}[1.0]", 1},
+		{"{2.0: 2}[2]", 2},
+		{"{1.5: 1}[1.5]", 1},
+		{"{1e19: 1}[10000000000 * 1000000000]", 1},
 		{"{}[0]", Null},
+		{`"héllo"[1]`, "é"},
+		{`"λx"[0]`, "λ"},
+		{`"λx"[2]`, Null},
+		{`"abc"[-1]`, Null},
 	}
 	runVmTests(t, tests)
 }
@@ -526,6 +1069,13 @@ fn(a, b) { a + b;}(1);
 `,
 			expected: `wrong number of arguments: want=2, got=1`,
 		},
+		{
+			input: `
+let add = fn(a, b) { a + b; };
+add(1);
+`,
+			expected: `wrong number of arguments to add: want=2, got=1`,
+		},
 	}
 	for _, tt := range tests {
 		program := parse(tt.input)
@@ -540,7 +1090,7 @@ fn(a, b) { a + b;}(1);
 		if err == nil {
 			t.Fatalf("expected VM error but resulted in non.")
 		}
-		if err.Error() != tt.expected {
+		if runtimeErrorMessage(err) != tt.expected {
 			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
 		}
 	}
@@ -552,6 +1102,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("λ>> ")`, 4},
+		{`len("日本語")`, 3},
 		{
 			`len(1)`,
 			&object.Error{
@@ -697,3 +1249,310 @@ fibonacci(15);
 
 	runVmTests(t, tests)
 }
+
+// runtimeErrorMessage return the message of err without the traceback
+func runtimeErrorMessage(err error) string {
+	if rerr, ok := err.(*RuntimeError); ok {
+		return rerr.Msg
+	}
+	return err.Error()
+}
+
+func TestRuntimeErrorTraceback(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{
+			"1 + true",
+			"unsupported types for binary operation: INTEGER BOOLEAN\n" +
+				"    at <main> (err.mk:1:1)",
+		},
+		{
+			`let divide = fn(a, b) {
+    a / b
+};
+let average = fn(xs) {
+    divide(xs[0] + xs[1], len(xs) - 2)
+};
+average([1, 2]);`,
+			"division by zero\n" +
+				"    at divide (err.mk:2:5)\n" +
+				"    at average (err.mk:5:5)\n" +
+				"    at <main> (err.mk:7:1)",
+		},
+		{
+			`let apply = fn(f) { f(1) };
+apply(fn(x) {
+    x[0]
+});`,
+			"index operator not supported: INTEGER\n" +
+				"    at <anonymous> (err.mk:3:5)\n" +
+				"    at apply (err.mk:1:21)\n" +
+				"    at <main> (err.mk:2:1)",
+		},
+		{
+			"let f = fn(x) { x };\nf(1, 2);",
+			"wrong number of arguments to f: want=1, got=2\n" +
+				"    at <main> (err.mk:2:1)",
+		},
+		{
+			"let f = fn(x) {\n    len(x)\n};\nf(1);",
+			"argument to `len` not supported, got=INTEGER\n" +
+				"    at len (err.mk:2:5)\n" +
+				"    at f (err.mk:2:5)\n" +
+				"    at <main> (err.mk:4:1)",
+		},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestLineTable(t *testing.T) {
+	input := `let f = fn(x) {
+    let y = x + 1;
+    y * 2
+};
+f(1);`
+	p := parser.New(lexer.NewFile("lines.mk", input))
+	program := p.ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var fn *object.CompiledFunction
+	for _, c := range bytecode.Constants {
+		if cf, ok := c.(*object.CompiledFunction); ok {
+			fn = cf
+		}
+	}
+	if fn == nil {
+		t.Fatalf("no compiled function in the constants")
+	}
+
+	// 每条指令都有位置，行号只增不减
+	line := 0
+	for pc := 0; pc < len(fn.Instructions); pc++ {
+		pos := fn.PosAt(pc)
+		if !pos.IsValid() || pos.File != "lines.mk" {
+			t.Fatalf("no position for pc %d. got=%s", pc, pos)
+		}
+		if pos.Line < line || pos.Line < 2 || pos.Line > 3 {
+			t.Errorf("wrong line for pc %d. got=%s", pc, pos)
+		}
+		line = pos.Line
+	}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	last := mainFn.PosAt(len(bytecode.Instructions) - 1)
+	if last.Line != 5 {
+		t.Errorf("wrong line for the last instruction. got=%s", last)
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fibonacci = fn(x) { x }; fibonacci", "<fn fibonacci(x)>"},
+		{"fn(a, b) { a + b }", "<fn(a, b)>"},
+		{"let f = fn() { 1 }; [f]", "[<fn f()>]"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		got := vm.LastPoppedStackElem().Inspect()
+		if got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`let r = 0; try { throw 1 } catch (e) { r = e } r`, 1},
+		{`let r = ""; try { 1 / 0 } catch (e) { r = e["type"] + ": " + e["message"] } r`, "RuntimeError: division by zero"},
+		{`let r = ""; try { len(1) } catch (e) { r = e["type"] + ": " + e["message"] } r`, "BuiltinError: argument to `len` not supported, got=INTEGER"},
+		{`let r = ""; try { 1 / 0 } catch (e) { r = first([e])["message"] } r`, "division by zero"},
+		{`let r = 0; try { r = 1 } finally { r = r + 10 } r`, 11},
+		{`
+let f = fn() { throw "boom" };
+let g = fn() { f() + 1 };
+let r = "";
+try { g() } catch (e) { r = e }
+r`, "boom"},
+		{`
+let n = 0;
+let f = fn() { try { return 1 } finally { n = 10 } };
+f() + n`, 11},
+		{`
+let f = fn(x) { try { throw x } catch (e) { return e * 2 } };
+1 + f(3)`, 7},
+		{`
+let n = 0;
+for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n = n + 1 } }
+n`, 2},
+		{`
+let r = "";
+try { try { throw "a" } finally { r = r + "f" } } catch (e) { r = r + e }
+r`, "fa"},
+		{`
+let r = "";
+try { try { throw "a" } catch (e) { throw e + "b" } finally { r = r + "f" } } catch (e) { r = r + e }
+r`, "fab"},
+		{`let a = [10, if (true) { try { [20, 1 / 0] } catch (e) { } 30 }]; a[0] + a[1]`, 40},
+		{`let add = fn(a, b) { a + b }; add(1, if (true) { try { throw 5 } catch (e) { } 2 })`, 3},
+		{`let f = fn() { try { throw 1 } finally { return 2 } }; f()`, 2},
+		// the parameter is seen only by the catch block
+		{`let f = fn() { let e = 7; try { throw 1 } catch (e) { e } e }; f()`, 7},
+		{`let e = 7; try { throw 1 } catch (e) { e }; e`, 7},
+		{`let f = 0; try { throw 3 } catch (e) { f = fn() { e } }; f()`, 3},
+		// a try has no value
+		{`try { throw "x" } catch (e) { e }`, Null},
+		{`try { 1 } finally { 2 }`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtException(t *testing.T) {
+	tests := []vmErrorTestCase{
+		{`throw "boom"`, "uncaught exception: boom"},
+		{`try { 1 / 0 } catch (e) { throw e }`, "division by zero"},
+		{`try { throw 1 } finally { 2 }`, "uncaught exception: 1"},
+		{`let f = fn() { try { len(1) } finally { 1 } }; f()`, "argument to `len` not supported, got=INTEGER"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestBuiltinErrorValues(t *testing.T) {
+	// 测试用的内置函数，返回的错误给脚本看
+	check := registerTestBuiltin(t, "check", func(args ...object.Object) object.Object {
+		if args[0] == True {
+			return True
+		}
+		return &object.Error{Message: "check failed", Kind: object.BUILTIN_ERROR}
+	})
+	check.ErrorValues = true
+
+	tests := []vmTestCase{
+		{`check(true)`, true},
+		{`check(false)["message"]`, "check failed"},
+		{`let e = check(false); len([e, e])`, 2},
+		{`let r = "none"; try { check(false) } catch (e) { r = "caught" } r`, "none"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSharedBuiltinError(t *testing.T) {
+	// 每次返回同一个错误，捕获它不能改掉它
+	failed := &object.Error{Message: "failed", Kind: object.BUILTIN_ERROR}
+	registerTestBuiltin(t, "fail", func(args ...object.Object) object.Object { return failed })
+
+	tests := []vmTestCase{
+		{`let r = ""; try { fail() } catch (e) { r = e["message"] } r`, "failed"},
+		{`try { fail() } catch (e) { }; fail(); 42`, &object.Error{Message: "failed"}},
+	}
+
+	runVmTests(t, tests)
+	if failed.Caught {
+		t.Errorf("the error returned by the builtin was changed")
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// MaxFrames is hit first
+		{"let f = fn() { f() }; f()", "stack overflow\n" +
+			"    at f (1:16)\n" +
+			"    ... repeated 1022 more times\n" +
+			"    at <main> (1:23)"},
+		// StackSize is hit first
+		{"let f = fn(x) { f(x + 1) }; f(0)", "stack overflow\n" +
+			"    at f (1:23)\n" +
+			"    at f (1:17)\n" +
+			"    ... repeated 1021 more times\n" +
+			"    at <main> (1:29)"},
+	}
+
+	for _, tt := range tests {
+		err := runVm(t, tt.input)
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Fatalf("%s: error is not a *RuntimeError. got=%T (%v)", tt.input, err, err)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, err)
+		}
+	}
+
+	runVmTests(t, []vmTestCase{
+		{`let f = fn() { f() }; let r = ""; try { f() } catch (e) { r = e["message"] } r`, "stack overflow"},
+	})
+}
+
+func TestBuiltinPanic(t *testing.T) {
+	// 宿主后加的内置函数，名字要从 Builtins 里找
+	registerTestBuiltin(t, "crash", func(args ...object.Object) object.Object {
+		return args[0].(*object.Integer)
+	})
+
+	input := `crash("a")`
+	expected := "builtin crash panicked: interface conversion: object.Object is *object.String, not *object.Integer\n" +
+		"    at crash (1:1)\n" +
+		"    at <main> (1:1)"
+	err := runVm(t, input)
+	if err == nil || err.Error() != expected {
+		t.Errorf("%s: wrong error.\nwant:\n%s\ngot:\n%v", input, expected, err)
+	}
+
+	runVmTests(t, []vmTestCase{
+		{`let r = ""; try { crash("a") } catch (e) { r = e["type"] } r`, "BuiltinError"},
+		{`crash(1)`, 1},
+	})
+}
+
+// registerTestBuiltin append a builtin to object.Builtins until the test
+// ends. Name is left empty like the builtins a host adds, BuiltinName find it
+func registerTestBuiltin(t *testing.T, name string, fn object.BuiltinFunction) *object.Builtin {
+	t.Helper()
+	builtins := object.Builtins
+	builtin := &object.Builtin{Fn: fn}
+	object.Builtins = append(object.Builtins, struct {
+		Name    string
+		Builtin *object.Builtin
+	}{Name: name, Builtin: builtin})
+	t.Cleanup(func() { object.Builtins = builtins })
+	return builtin
+}
+
+// runVm compile input and run it, returning the error of Run
+func runVm(t *testing.T, input string) error {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(comp.Bytecode()).Run()
+}
+
+func TestStackUnderflow(t *testing.T) {
+	// 坏的字节码，栈上什么都没有
+	bytecode := &compiler.Bytecode{Instructions: code.Make(code.OpPop)}
+	vm := New(bytecode)
+	err := vm.Run()
+	if err == nil || err.Error() != "stack underflow\n    at <main>" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}